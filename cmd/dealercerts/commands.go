@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cheesesashimi/subiescraper/pkg/dealer"
+	"github.com/cheesesashimi/subiescraper/pkg/discovery"
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func dealerURLsFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "dealer-urls",
+		Usage: "File of dealer URLs, one per line, to seed the hosts file with when it doesn't exist",
+		Value: dealersFile,
+	}
+}
+
+func hostsFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "hosts",
+		Usage: "JSON file of dealer hosts and whether they've been visited",
+		Value: hostsFile,
+	}
+}
+
+func classifiedFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "classified",
+		Usage: "JSON file of dealers keyed by make",
+		Value: classifiedDealersFile,
+	}
+}
+
+func graphFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "graph",
+		Usage: "JSON file of the hosts found and the certificates they share",
+		Value: graphFile,
+	}
+}
+
+func outputFlag(usage string) cli.Flag {
+	return &cli.StringFlag{
+		Name:  "output",
+		Usage: usage,
+	}
+}
+
+// outputPath returns --output, or the input flag's path when it isn't given
+// so the input is updated in place.
+func outputPath(c *cli.Context, inputFlag string) string {
+	if out := c.String("output"); out != "" {
+		return out
+	}
+
+	return c.String(inputFlag)
+}
+
+// exportGraph writes the graph to output, or stdout if it is empty, in the
+// given format.
+func exportGraph(graphPath, format, output string) error {
+	graph, err := discovery.LoadGraph(graphPath)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return writeGraph(os.Stdout, graph, format)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err := writeGraph(f, graph, format); err != nil {
+		f.Close()
+		return err
+	}
+
+	// The file isn't fully written until it's closed.
+	return f.Close()
+}
+
+// writeGraph writes the graph to out in the format given to exportGraph.
+func writeGraph(out io.Writer, graph *discovery.Graph, format string) error {
+	switch format {
+	case "dot":
+		return graph.WriteDOT(out)
+	case "graphml":
+		return graph.WriteGraphML(out)
+	case "groups":
+		for _, group := range graph.Groups() {
+			if len(group) > 1 {
+				if _, err := fmt.Fprintln(out, strings.Join(group, " ")); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown graph format %q, expected dot, graphml or groups", format)
+	}
+}
+
+// markLocatorDealers records which dealers are listed by the dealer locators
+// saved in each make=path locator file, as evidence of the makes they sell.
+func markLocatorDealers(dealers []dealer.DealerResponse, locatorFiles []string) error {
+	for _, locatorFile := range locatorFiles {
+		make, path, ok := strings.Cut(locatorFile, "=")
+		if !ok || make == "" || path == "" {
+			return fmt.Errorf("invalid --locator-file %q, expected make=path", locatorFile)
+		}
+
+		locatorDealers, err := (&dealer.FileLocator{Make: make, Path: path}).Dealers()
+		if err != nil {
+			return err
+		}
+
+		marked := dealer.MarkLocatorDealers(dealers, make, locatorDealers)
+		logger.Info("marked dealers listed by dealer locator", "make", make, "path", path, "locatorDealers", len(locatorDealers), "marked", marked)
+	}
+
+	return nil
+}
+
+// getRules loads --rules, or the built-in rules, with --deny and --allow
+// checked before them.
+func getRules(c *cli.Context) (discovery.RuleSet, error) {
+	rules := defaultRules()
+	if path := c.String("rules"); path != "" {
+		var err error
+		rules, err = discovery.LoadRules(path)
+		if err != nil {
+			return rules, err
+		}
+	}
+
+	extra := []discovery.Rule{}
+	for _, pattern := range c.StringSlice("deny") {
+		extra = append(extra, discovery.Rule{Action: discovery.Deny, Pattern: pattern})
+	}
+
+	for _, pattern := range c.StringSlice("allow") {
+		extra = append(extra, discovery.Rule{Action: discovery.Allow, Pattern: pattern})
+	}
+
+	return rules.Prepend(extra...), nil
+}
+
+// printExpiringCerts lists the hosts whose certificates expire within the
+// given time of now, soonest first, and optionally the ones which didn't
+// verify.
+func printExpiringCerts(out io.Writer, hostsPath string, now time.Time, within time.Duration, unverified bool) error {
+	if _, err := os.Stat(hostsPath); err != nil {
+		return fmt.Errorf("no hosts file, run discover first: %w", err)
+	}
+
+	hosts, err := loadHostsFile(hostsPath, "")
+	if err != nil {
+		return err
+	}
+
+	listed := []DealerHost{}
+	for _, h := range hosts {
+		if h.TLS == nil {
+			continue
+		}
+
+		if h.TLS.ExpiresWithin(now, within) || (unverified && !h.TLS.Verified) {
+			listed = append(listed, h)
+		}
+	}
+
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].TLS.NotAfter.Before(listed[j].TLS.NotAfter)
+	})
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tEXPIRES\tDAYS LEFT\tISSUER\tTLS\tVERIFIED")
+	for _, h := range listed {
+		daysLeft := int(h.TLS.NotAfter.Sub(now).Hours() / 24)
+
+		verified := "yes"
+		if !h.TLS.Verified {
+			verified = fmt.Sprintf("no: %s", h.TLS.VerifyError)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", h.Hostname, h.TLS.NotAfter.Format("2006-01-02"), daysLeft, h.TLS.Issuer, h.TLS.TLSVersion, verified)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d of %d hosts with a recorded certificate listed\n", len(listed), countTLS(hosts))
+
+	return nil
+}
+
+func countTLS(hosts []DealerHost) int {
+	count := 0
+	for _, h := range hosts {
+		if h.TLS != nil {
+			count++
+		}
+	}
+
+	return count
+}
+
+func printStats(out io.Writer, hostsPath, classifiedPath string) error {
+	visited := 0
+	hosts := []DealerHost{}
+
+	if _, err := os.Stat(hostsPath); err == nil {
+		hosts, err = loadHostsFile(hostsPath, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, h := range hosts {
+		if h.Visited {
+			visited++
+		}
+	}
+
+	fmt.Fprintf(out, "Hosts: %d (%d visited, %d not visited)\n", len(hosts), visited, len(hosts)-visited)
+
+	classified, err := readClassifiedDealersFile(classifiedPath)
+	if err != nil {
+		return err
+	}
+
+	// A dealer which sells several makes is listed under each of them, so
+	// dealers are counted by hostname.
+	makes := []string{}
+	all := sets.NewString()
+	byMake := map[string]sets.String{}
+	for make, dealers := range classified {
+		makes = append(makes, make)
+		byMake[make] = sets.NewString()
+
+		for _, d := range dealers {
+			key := d.SiteURL
+			if hostname, err := utils.StripHostname(d.SiteURL); err == nil {
+				key = hostname
+			}
+
+			all.Insert(key)
+			byMake[make].Insert(key)
+		}
+	}
+
+	sort.Strings(makes)
+
+	fmt.Fprintf(out, "Dealers: %d\n", all.Len())
+	for _, make := range makes {
+		fmt.Fprintf(out, "- %s: %d\n", make, byMake[make].Len())
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cheesesashimi/subiescraper/pkg/dealer"
+)
+
+func TestPrintStatsCountsDealersOnce(t *testing.T) {
+	dir := t.TempDir()
+
+	// Smith sells both makes and is listed under each, once without www.
+	classified := map[string][]dealer.DealerResponse{
+		"subaru": {
+			{Name: "Smith Subaru", SiteURL: "https://www.smithmotors.com"},
+			{Name: "Jones Subaru", SiteURL: "https://www.jonessubaru.com"},
+		},
+		"toyota": {
+			{Name: "Smith Toyota", SiteURL: "https://smithmotors.com/"},
+		},
+	}
+
+	b, err := json.Marshal(classified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classifiedPath := filepath.Join(dir, "classified.json")
+	if err := os.WriteFile(classifiedPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := printStats(out, filepath.Join(dir, "hosts.json"), classifiedPath); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Hosts: 0 (0 visited, 0 not visited)\nDealers: 2\n- subaru: 2\n- toyota: 1\n"
+	if got := out.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
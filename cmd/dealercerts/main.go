@@ -1,74 +1,75 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
-	"net/url"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gammazero/workerpool"
-
 	"github.com/cheesesashimi/subiescraper/pkg/dealer"
+	"github.com/cheesesashimi/subiescraper/pkg/discovery"
 	"github.com/cheesesashimi/subiescraper/pkg/html"
+	"github.com/cheesesashimi/subiescraper/pkg/logging"
 	"github.com/cheesesashimi/subiescraper/pkg/utils"
+	"github.com/urfave/cli/v2"
+	aggError "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 const (
 	dealersFile           string = "dealerurls.txt"
+	hostsFile             string = "hosts.json"
+	checkpointFile        string = "discovery-checkpoint.json"
+	graphFile             string = "dealer-graph.json"
 	classifiedDealersFile string = "classified-dealers.json"
 )
 
-func getInterestedMakesAndModels() map[string]url.Values {
-	return map[string]url.Values{
-		"acura": url.Values{
-			"make":  []string{"Acura"},
-			"model": []string{"TLX", "Integra"},
-		},
-		"honda": url.Values{
-			"make":               []string{"Honda"},
-			"model":              []string{"Civic", "Civic Si", "Civic Type-R"},
-			"normalTransmission": []string{"Manual"},
+func getInterestedMakesAndModels() map[string]dealer.InventoryQuery {
+	return map[string]dealer.InventoryQuery{
+		"acura": dealer.InventoryQuery{
+			Make:   "Acura",
+			Models: []string{"TLX", "Integra"},
 		},
-		"hyundai": url.Values{
-			"make":               []string{"Hyundai"},
-			"model":              []string{"Veloster", "Elantra"},
-			"normalTransmission": []string{"Manual"},
+		"honda": dealer.InventoryQuery{
+			Make:         "Honda",
+			Models:       []string{"Civic", "Civic Si", "Civic Type-R"},
+			Transmission: "Manual",
 		},
-		"lexus": url.Values{
-			"make":  []string{"Lexus"},
-			"model": []string{"IS500"},
+		"hyundai": dealer.InventoryQuery{
+			Make:         "Hyundai",
+			Models:       []string{"Veloster", "Elantra"},
+			Transmission: "Manual",
 		},
-		"nissan": url.Values{
-			"make":  []string{"Nissan"},
-			"model": []string{"Z"},
+		"lexus": dealer.InventoryQuery{
+			Make:   "Lexus",
+			Models: []string{"IS500"},
 		},
-		"subaru": url.Values{
-			"make":               []string{"Subaru"},
-			"model":              []string{"WRX", "BRZ"},
-			"normalTransmission": []string{"Manual"},
+		"nissan": dealer.InventoryQuery{
+			Make:   "Nissan",
+			Models: []string{"Z"},
 		},
-		"toyota": url.Values{
-			"make":  []string{"Toyota"},
-			"model": []string{"86", "Supra"},
+		"subaru": dealer.InventoryQuery{
+			Make:         "Subaru",
+			Models:       []string{"WRX", "BRZ"},
+			Transmission: "Manual",
 		},
-		"volkswagen": url.Values{
-			"make":               []string{"Volkswagen"},
-			"model":              []string{"Jetta", "Jetta GLI", "GTI", "Golf", "Golf-R"},
-			"normalTransmission": []string{"Manual"},
+		"toyota": dealer.InventoryQuery{
+			Make:   "Toyota",
+			Models: []string{"86", "Supra"},
 		},
-		"vw": url.Values{
-			"make":               []string{"Volkswagen"},
-			"model":              []string{"Jetta", "Jetta GLI", "GTI", "Golf", "Golf-R"},
-			"normalTransmission": []string{"Manual"},
+		"volkswagen": dealer.InventoryQuery{
+			Make:         "Volkswagen",
+			Models:       []string{"Jetta", "Jetta GLI", "GTI", "Golf", "Golf-R"},
+			Transmission: "Manual",
 		},
 	}
 }
@@ -77,35 +78,40 @@ func getInterestedMakes() []string {
 	return sets.StringKeySet(getInterestedMakesAndModels()).List()
 }
 
-func classifyDealers(dealers []dealer.DealerResponse) map[string][]dealer.DealerResponse {
-	knownMakes := getInterestedMakes()
+// defaultMinConfidence is how confident dealer.ClassifyFranchises has to be
+// that a dealer sells a make for it to be filed under that make. It is low
+// enough that a dealer named after a make, such as smithsubaru.com, is still
+// filed under it when nothing else is known about it.
+const defaultMinConfidence = 0.25
+
+// classifyDealers files each dealer under every make it sells with at least
+// minConfidence, and under unclassified if there aren't any.
+func classifyDealers(dealers []dealer.DealerResponse, minConfidence float64) map[string][]dealer.DealerResponse {
 	out := map[string][]dealer.DealerResponse{}
 
-	for _, knownMake := range knownMakes {
+	for _, knownMake := range getInterestedMakes() {
 		out[knownMake] = []dealer.DealerResponse{}
 	}
 
-	for _, dealer := range dealers {
+	for _, d := range dealers {
+		d.Franchises = dealer.ClassifyFranchises(d)
+
 		added := false
-		for _, knownMake := range knownMakes {
-			if !strings.Contains(dealer.SiteURL, knownMake) {
+		for _, f := range d.Franchises {
+			if f.Confidence < minConfidence {
 				continue
 			}
 
-			out[knownMake] = append(out[knownMake], dealer)
+			key := dealer.MakeKey(f.Make)
+			out[key] = append(out[key], d)
 			added = true
 		}
 
 		if !added {
-			out["unclassified"] = append(out["unclassified"], dealer)
+			out["unclassified"] = append(out["unclassified"], d)
 		}
 	}
 
-	// Combine VW and Volkswagen
-	tmp := mergeDealers(out["volkswagen"], out["vw"])
-	delete(out, "vw")
-	out["volkswagen"] = tmp
-
 	for knownMake, dealers := range out {
 		out[knownMake] = sortDealers(dealers)
 	}
@@ -113,16 +119,16 @@ func classifyDealers(dealers []dealer.DealerResponse) map[string][]dealer.Dealer
 	return out
 }
 
-func readClassifiedDealersFile() (map[string][]dealer.DealerResponse, error) {
+func readClassifiedDealersFile(path string) (map[string][]dealer.DealerResponse, error) {
 	out := map[string][]dealer.DealerResponse{}
 
-	if _, err := os.Stat(classifiedDealersFile); err != nil {
+	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
 			return out, nil
 		}
 	}
 
-	b, err := ioutil.ReadFile(classifiedDealersFile)
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return out, err
 	}
@@ -132,39 +138,33 @@ func readClassifiedDealersFile() (map[string][]dealer.DealerResponse, error) {
 	return out, err
 }
 
-func readClassifiedDealersFileAndFlatten() ([]dealer.DealerResponse, error) {
+func readClassifiedDealersFileAndFlatten(path string) ([]dealer.DealerResponse, error) {
 	out := []dealer.DealerResponse{}
 
-	tmp, err := readClassifiedDealersFile()
+	tmp, err := readClassifiedDealersFile(path)
 	if err != nil {
 		return out, err
 	}
 
+	// Dealers which sell several makes are filed under each of them.
 	for key := range tmp {
-		out = append(out, tmp[key]...)
+		out = mergeDealers(out, tmp[key])
 	}
 
-	return sortDealers(out), nil
+	return out, nil
 }
 
-func writeClassifiedDealersFilePreclassed(classified map[string][]dealer.DealerResponse) error {
+func writeClassifiedDealersFilePreclassed(path string, classified map[string][]dealer.DealerResponse) error {
 	b, err := json.Marshal(classified)
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(classifiedDealersFile, b, 0755)
+	return utils.WriteFileAtomic(path, b, 0755)
 }
 
-func writeClassifiedDealersFile(dealers []dealer.DealerResponse) error {
-	classified := classifyDealers(dealers)
-
-	b, err := json.Marshal(classified)
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(classifiedDealersFile, b, 0755)
+func writeClassifiedDealersFile(path string, dealers []dealer.DealerResponse, minConfidence float64) error {
+	return writeClassifiedDealersFilePreclassed(path, classifyDealers(dealers, minConfidence))
 }
 
 func sortDealers(dealers []dealer.DealerResponse) []dealer.DealerResponse {
@@ -194,119 +194,82 @@ func mergeDealers(d1, d2 []dealer.DealerResponse) []dealer.DealerResponse {
 	return sortDealers(out)
 }
 
-func loadFile() sets.String {
-	b, err := ioutil.ReadFile("dealerurls.txt")
+func loadFile(path string) (sets.String, error) {
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	urls := sets.NewString()
 
-	for _, dealerURL := range strings.Split(string(b), "\n") {
-		if dealerURL != "" {
-			stripped := utils.StripHostname(dealerURL)
-			urls.Insert(stripped)
-		}
-	}
-
-	return urls
-}
-
-func isInterestedMake(hostname string) bool {
-	for _, knownMake := range getInterestedMakes() {
-		if strings.Contains(hostname, knownMake) {
-			return true
+	for i, dealerURL := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(dealerURL) == "" {
+			continue
 		}
-	}
-
-	return false
-}
 
-func filtered(dnsName, url string) bool {
-	return strings.Contains(dnsName, "dealer.com") || strings.Contains(url, dnsName) || strings.Contains(dnsName, "cloudflare.com") || !isInterestedMake(dnsName)
-}
-
-func scrapeDealerWebsite(dealerHost string, dnsHosts chan sets.String, dealerChan chan dealer.DealerResponse) {
-	dnsNames, dealerByteBuf, err := doScrapeDealerWebsite(dealerHost)
-	if err != nil {
-		fmt.Println("Skipping:", err)
-		return
-	}
-
-	go func() {
-		start := time.Now()
-
-		dealerResp, err := dealer.GetDealerResponseFromReader(dealerByteBuf, dealerHost)
+		stripped, err := utils.StripHostname(dealerURL)
 		if err != nil {
-			fmt.Println(err)
+			logger.Warn("skipping invalid dealer URL", "file", path, "line", i+1, "error", err)
+			continue
 		}
 
-		fmt.Println("Extracted contents from", utils.HostnameToURL(dealerHost), "in", time.Since(start))
-		dealerChan <- dealerResp
-	}()
-
-	go func() {
-		dnsHosts <- dnsNames
-	}()
-}
-
-func doScrapeDealerWebsite(dealerHost string) (sets.String, *bytes.Buffer, error) {
-	dnsHostsOut := sets.NewString()
-
-	dealerURL := utils.HostnameToURL(dealerHost)
-
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("GET", dealerURL, nil)
-	if err != nil {
-		return dnsHostsOut, nil, err
+		urls.Insert(stripped)
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.55 Safari/537.36")
+	return urls, nil
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return dnsHostsOut, nil, err
+// defaultRules are used when --rules isn't given. They deny the hostnames on
+// shared certificates, such as Dealer.com's and Cloudflare's, and the ones for
+// makes we aren't interested in.
+func defaultRules() discovery.RuleSet {
+	rs := discovery.RuleSet{
+		Rules: []discovery.Rule{
+			{Action: discovery.Deny, Pattern: "*dealer.com*"},
+			{Action: discovery.Deny, Pattern: "*cloudflare.com*"},
+		},
+		Default: discovery.Deny,
 	}
 
-	defer resp.Body.Close()
-	bytesBuf := bytes.NewBuffer([]byte{})
-
-	if _, err := io.Copy(bytesBuf, resp.Body); err != nil {
-		return dnsHostsOut, nil, err
+	for _, knownMake := range getInterestedMakes() {
+		for _, keyword := range dealer.MakeKeywords(knownMake) {
+			rs.Rules = append(rs.Rules, discovery.Rule{
+				Action:  discovery.Allow,
+				Pattern: fmt.Sprintf("*%s*", keyword),
+			})
+		}
 	}
 
-	return getDNSNamesFromResponse(resp, dealerURL), bytesBuf, nil
+	return rs
 }
 
-func getDNSNamesFromResponse(resp *http.Response, dealerURL string) sets.String {
-	out := sets.NewString()
-
-	if resp.TLS == nil {
-		return out
+// linkRules are used for linked hosts with a dealer word, e.g.
+// smithmotors.com. They are the same as rules, but allow the hosts no rule
+// matches since they rarely have a make in them.
+func linkRules(rules discovery.RuleSet) discovery.RuleSet {
+	return discovery.RuleSet{
+		Rules:   rules.Rules,
+		Default: discovery.Allow,
 	}
-
-	for _, cert := range resp.TLS.PeerCertificates {
-		if cert == nil {
-			continue
-		}
-
-		for _, name := range cert.DNSNames {
-			formatted := utils.StripHostname(name)
-			if !filtered(formatted, dealerURL) {
-				out.Insert(formatted)
-			}
-		}
-	}
-
-	return out
 }
 
 type DealerHost struct {
 	Hostname string `json:"hostname"`
 	Visited  bool   `json:"visited"`
+	// Path is how the host was discovered, from the seed it was crawled
+	// from to the host itself, and Channel is whether it was on the
+	// certificate of the host before it or linked from its landing page.
+	// Certificate is the SHA-256 fingerprint of the certificate it was
+	// found on and LinkScore the score of the link it was found from.
+	Path        []string          `json:"path,omitempty"`
+	Channel     discovery.Channel `json:"channel,omitempty"`
+	Certificate string            `json:"certificate,omitempty"`
+	LinkScore   float64           `json:"linkScore,omitempty"`
+	// TLS describes the host's own certificate as of its last visit.
+	TLS *discovery.CertificateInfo `json:"tls,omitempty"`
+	// Source is where the seed it was found from came from, if not the
+	// dealer URLs file, e.g. the Certificate Transparency search.
+	Source string `json:"source,omitempty"`
 }
 
 func dealerHostsToSet(dh []DealerHost) sets.String {
@@ -319,31 +282,38 @@ func dealerHostsToSet(dh []DealerHost) sets.String {
 	return out
 }
 
-func loadHostsFile() []DealerHost {
+// loadHostsFile reads the hosts file, or seeds it from the dealer URLs file
+// if it doesn't exist yet.
+func loadHostsFile(hostsPath, dealerURLsPath string) ([]DealerHost, error) {
 	dh := []DealerHost{}
 
-	_, err := os.Stat("hosts.json")
+	_, err := os.Stat(hostsPath)
 	if !os.IsNotExist(err) {
-		b, err := ioutil.ReadFile("hosts.json")
+		b, err := ioutil.ReadFile(hostsPath)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 
 		if err := json.Unmarshal(b, &dh); err != nil {
-			panic(err)
+			return nil, fmt.Errorf("could not parse %s: %w", hostsPath, err)
 		}
 
-		return sortDealerHosts(dh)
+		return sortDealerHosts(dh), nil
 	}
 
-	for host := range loadFile() {
+	hosts, err := loadFile(dealerURLsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for host := range hosts {
 		dh = append(dh, DealerHost{
 			Hostname: host,
 			Visited:  false,
 		})
 	}
 
-	return sortDealerHosts(dh)
+	return sortDealerHosts(dh), nil
 }
 
 func printDealerHostStats(dh []DealerHost) {
@@ -360,9 +330,7 @@ func printDealerHostStats(dh []DealerHost) {
 		}
 	}
 
-	fmt.Println("Found", visited, "hosts we visited")
-	fmt.Println("Found", notVisited, "hosts that need visited")
-	fmt.Println("Total:", total)
+	logger.Info("dealer host stats", "visited", visited, "notVisited", notVisited, "total", total)
 }
 
 func sortDealerHosts(dh []DealerHost) []DealerHost {
@@ -373,7 +341,7 @@ func sortDealerHosts(dh []DealerHost) []DealerHost {
 	return dh
 }
 
-func writeHostsFile(dh []DealerHost) error {
+func writeHostsFile(path string, dh []DealerHost) error {
 	printDealerHostStats(dh)
 
 	dh = sortDealerHosts(dh)
@@ -383,13 +351,13 @@ func writeHostsFile(dh []DealerHost) error {
 		return err
 	}
 
-	return ioutil.WriteFile("hosts.json", b, 0755)
+	return utils.WriteFileAtomic(path, b, 0755)
 }
 
-func dedupeClassifiedDealers() {
-	dealerRespsClassified, err := readClassifiedDealersFile()
+func dedupeClassifiedDealers(inPath, outPath string) error {
+	dealerRespsClassified, err := readClassifiedDealersFile(inPath)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	for key, dealerResps := range dealerRespsClassified {
@@ -409,217 +377,585 @@ func dedupeClassifiedDealers() {
 
 		after := len(deduped)
 
-		fmt.Println("Deduped", key, "Before:", before, "After:", after)
+		logger.Info("deduped dealers", "make", key, "before", before, "after", after)
 
 		dealerRespsClassified[key] = deduped
 	}
 
-	writeClassifiedDealersFilePreclassed(dealerRespsClassified)
+	return writeClassifiedDealersFilePreclassed(outPath, dealerRespsClassified)
 }
 
+var logger = logging.Discard()
+
 func main() {
-	findAllDealers()
+	app := &cli.App{
+		Name:  "dealercerts",
+		Usage: "Discover car dealer websites by crawling their TLS certificates",
+		Flags: logging.Flags(),
+		Before: func(c *cli.Context) error {
+			l, err := logging.FromContext(c)
+			if err != nil {
+				return err
+			}
+
+			logger = l
+			dealer.SetLogger(l)
+			discovery.SetLogger(l)
+
+			return nil
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "discover",
+				Usage: "Crawl dealer websites for new dealer hosts on their certificates and extract each dealer",
+				Flags: []cli.Flag{
+					dealerURLsFlag(),
+					hostsFlag(),
+					classifiedFlag(),
+					graphFlag(),
+					&cli.StringFlag{
+						Name:  "checkpoint",
+						Usage: "Where to save the crawl's progress; an existing checkpoint is resumed from and removed once the crawl finishes",
+						Value: checkpointFile,
+					},
+					&cli.DurationFlag{
+						Name:  "checkpoint-interval",
+						Usage: "How often to save the crawl's progress",
+						Value: 30 * time.Second,
+					},
+					&cli.IntFlag{
+						Name:  "max-depth",
+						Usage: "How many certificates or links away from the unvisited hosts to crawl, 0 for no limit; hosts further away are crawled the next time",
+					},
+					&cli.IntFlag{
+						Name:  "max-hosts",
+						Usage: "How many hosts to crawl, 0 for no limit; the rest are crawled the next time",
+					},
+					&cli.DurationFlag{
+						Name:  "max-time",
+						Usage: "How long to crawl for, e.g. 30m, 0 for no limit; the crawl is resumed from the checkpoint the next time",
+					},
+					&cli.StringFlag{
+						Name:  "rules",
+						Usage: "File of allow and deny rules deciding which hosts are crawled, instead of the built-in rules for the makes we're interested in",
+					},
+					&cli.StringSliceFlag{
+						Name:  "allow",
+						Usage: "Crawl hosts matching this pattern, checked before --rules, can be combined: --allow '*subaru*' --allow example.com",
+					},
+					&cli.StringSliceFlag{
+						Name:  "deny",
+						Usage: "Don't crawl hosts matching this pattern, checked before --allow and --rules, can be combined",
+					},
+					&cli.BoolFlag{
+						Name:  "follow-links",
+						Usage: "Also crawl the websites each dealer's landing page links to which look like dealerships, such as a dealer group's sister stores. Ones with a dealer word, such as Smith Motors, are crawled unless a rule denies them",
+					},
+					&cli.Float64Flag{
+						Name:  "min-link-score",
+						Usage: "How likely, from 0 to 1, a linked website has to be a dealership to crawl it with --follow-links",
+						Value: 0.5,
+					},
+					&cli.BoolFlag{
+						Name:  "insecure",
+						Usage: "Also crawl the hosts on certificates which didn't verify, e.g. expired or self-signed ones, and put them in the dealer graph",
+					},
+					&cli.BoolFlag{
+						Name:  "ct",
+						Usage: "Search the Certificate Transparency logs at --ct-url for new hosts to crawl",
+					},
+					&cli.StringFlag{
+						Name:  "ct-url",
+						Usage: "Base URL of a crt.sh compatible Certificate Transparency search, e.g. a local stand-in serving saved results",
+						Value: discovery.DefaultCTBaseURL,
+					},
+					&cli.StringSliceFlag{
+						Name:  "ct-file",
+						Usage: "File of saved crt.sh JSON results to find new hosts to crawl in, can be combined",
+					},
+					&cli.StringSliceFlag{
+						Name:  "ct-pattern",
+						Usage: "crt.sh pattern of the hostnames to look for in the Certificate Transparency logs, where % is a wildcard, can be combined, defaults to one for each of the makes we're interested in: --ct-pattern '%subaru%'",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					rules, err := getRules(c)
+					if err != nil {
+						return err
+					}
+
+					ctURL := ""
+					if c.Bool("ct") {
+						ctURL = c.String("ct-url")
+					}
+
+					ctPatterns := c.StringSlice("ct-pattern")
+					if len(ctPatterns) == 0 {
+						ctPatterns = defaultCTPatterns()
+					}
+
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+
+					return findAllDealers(ctx, discoverPaths{
+						dealerURLs: c.String("dealer-urls"),
+						hosts:      c.String("hosts"),
+						classified: c.String("classified"),
+						checkpoint: c.String("checkpoint"),
+						graph:      c.String("graph"),
+						ctFiles:    c.StringSlice("ct-file"),
+					}, discoverOptions{
+						checkpointInterval: c.Duration("checkpoint-interval"),
+						maxDepth:           c.Int("max-depth"),
+						maxHosts:           c.Int("max-hosts"),
+						maxTime:            c.Duration("max-time"),
+						rules:              rules,
+						followLinks:        c.Bool("follow-links"),
+						minLinkScore:       c.Float64("min-link-score"),
+						insecure:           c.Bool("insecure"),
+						ctURL:              ctURL,
+						ctPatterns:         ctPatterns,
+					})
+				},
+			},
+			{
+				Name:  "classify",
+				Usage: "Sort the dealers in the classified dealers file by the makes they sell again",
+				Flags: []cli.Flag{
+					classifiedFlag(),
+					outputFlag("where to write the classified dealers, defaults to --classified"),
+					&cli.Float64Flag{
+						Name:  "min-confidence",
+						Usage: "How confident, from 0 to 1, we have to be that a dealer sells a make to file it under that make",
+						Value: defaultMinConfidence,
+					},
+					&cli.StringSliceFlag{
+						Name:  "locator-file",
+						Usage: "JSON file of the dealers listed by a make's dealer locator, e.g. a saved subaru.com response, as make=path; can be combined",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					dealers, err := readClassifiedDealersFileAndFlatten(c.String("classified"))
+					if err != nil {
+						return err
+					}
+
+					if err := markLocatorDealers(dealers, c.StringSlice("locator-file")); err != nil {
+						return err
+					}
+
+					return writeClassifiedDealersFile(outputPath(c, "classified"), dealers, c.Float64("min-confidence"))
+				},
+			},
+			{
+				Name:  "dedupe",
+				Usage: "Remove duplicate dealers from the classified dealers file",
+				Flags: []cli.Flag{
+					classifiedFlag(),
+					outputFlag("where to write the deduped dealers, defaults to --classified"),
+				},
+				Action: func(c *cli.Context) error {
+					return dedupeClassifiedDealers(c.String("classified"), outputPath(c, "classified"))
+				},
+			},
+			{
+				Name:  "inventory",
+				Usage: "Write an HTML report of the inventory of the classified dealers for each make (<make>-cars.html)",
+				Flags: []cli.Flag{
+					classifiedFlag(),
+					graphFlag(),
+					&cli.StringFlag{
+						Name:  "output-dir",
+						Usage: "Directory to write the HTML reports to",
+						Value: ".",
+					},
+					&cli.StringSliceFlag{
+						Name:  "make",
+						Usage: "Only report on these makes, can be combined: --make honda --make subaru",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return getAllInventory(c.String("classified"), c.String("graph"), c.String("output-dir"), c.StringSlice("make"))
+				},
+			},
+			{
+				Name:  "graph",
+				Usage: "Export the graph of hosts which share certificates, whose connected components are dealer groups",
+				Flags: []cli.Flag{
+					graphFlag(),
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format to export the graph in: dot, graphml or groups (one dealer group per line)",
+						Value: "dot",
+					},
+					outputFlag("where to write the graph, defaults to stdout"),
+				},
+				Action: func(c *cli.Context) error {
+					return exportGraph(c.String("graph"), c.String("format"), c.String("output"))
+				},
+			},
+			{
+				Name:  "certs",
+				Usage: "List the hosts whose certificates have expired or are about to, which scrapes of them tend to fail on",
+				Flags: []cli.Flag{
+					hostsFlag(),
+					&cli.DurationFlag{
+						Name:  "within",
+						Usage: "Also list certificates which expire within this long",
+						Value: 30 * 24 * time.Hour,
+					},
+					&cli.BoolFlag{
+						Name:  "unverified",
+						Usage: "Also list certificates which didn't verify for any other reason, e.g. a missing intermediate or a name mismatch",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return printExpiringCerts(os.Stdout, c.String("hosts"), time.Now(), c.Duration("within"), c.Bool("unverified"))
+				},
+			},
+			{
+				Name:  "stats",
+				Usage: "Print how many hosts have been visited and how many dealers there are for each make",
+				Flags: []cli.Flag{
+					hostsFlag(),
+					classifiedFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					return printStats(os.Stdout, c.String("hosts"), c.String("classified"))
+				},
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func getAllInventory() {
-	dealerRespsClassified, err := readClassifiedDealersFile()
+// getAllInventory writes an HTML report of the inventory of every classified
+// dealer, along with its dealer group from the graph, to <make>-cars.html in
+// outputDir. If makes is empty, every make which has a query is reported on.
+func getAllInventory(classifiedPath, graphPath, outputDir string, makes []string) error {
+	dealerRespsClassified, err := readClassifiedDealersFile(classifiedPath)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	graph, err := discovery.LoadGraph(graphPath)
+	if err != nil {
+		return err
+	}
+
+	groups := graph.GroupNames()
+
 	mnm := getInterestedMakesAndModels()
 
 	for key, dealerResps := range dealerRespsClassified {
+		if _, ok := mnm[key]; !ok {
+			logger.Debug("skipping make without an inventory query", "make", key)
+			continue
+		}
+
+		if len(makes) != 0 && !sets.NewString(makes...).Has(key) {
+			continue
+		}
+
 		dealers := []dealer.Dealer{}
-		fmt.Println("Querying for", key, "inventory:")
+		logger.Info("querying inventory", "make", key)
 		for _, dealerResp := range dealerResps {
-			fmt.Println("Querying", dealerResp.Name, dealerResp.SiteURL)
+			dealerResp.DealerGroup = discovery.GroupName(groups, dealerResp.SiteURL)
+			logger.Info("querying dealer", "make", key, "dealer", dealerResp.Name, "url", dealerResp.SiteURL)
 			out, err := dealer.GetDealerAndInventory(dealerResp, mnm[key])
 			if err != nil {
-				fmt.Println("Could not get inventory for:", mnm[key], dealerResp.SiteURL, err)
+				logger.Error("could not get inventory", "make", key, "dealer", dealerResp.Name, "url", dealerResp.SiteURL, "error", err)
 				continue
 			}
 			dealers = append(dealers, out)
 		}
 
-		filename := fmt.Sprintf("%s-cars.html", key)
-		fmt.Println("Writing to:", filename)
+		filename := filepath.Join(outputDir, fmt.Sprintf("%s-cars.html", key))
+		logger.Info("writing HTML report", "make", key, "filename", filename)
 		if err := html.DealersPageToFile(dealers, filename); err != nil {
-			fmt.Println("could not write to", filename, "Error:", err)
+			logger.Error("could not write HTML report", "make", key, "filename", filename, "error", err)
 		}
 	}
+
+	return nil
 }
 
-func findAllDealers() {
-	hostSetChan := make(chan sets.String)
-	dealerHostChan := make(chan DealerHost)
-	dealerRespChan := make(chan dealer.DealerResponse)
+// discoverPaths are the files read and written by findAllDealers.
+type discoverPaths struct {
+	dealerURLs string
+	hosts      string
+	classified string
+	checkpoint string
+	graph      string
+	// ctFiles are saved crt.sh JSON results to find new seeds in.
+	ctFiles []string
+}
 
-	hosts := loadHostsFile()
-	printDealerHostStats(hosts)
+// discoverOptions bound the crawl done by findAllDealers and decide which
+// hosts it crawls.
+type discoverOptions struct {
+	checkpointInterval time.Duration
+	maxDepth           int
+	maxHosts           int
+	maxTime            time.Duration
+	rules              discovery.RuleSet
+	// followLinks also crawls the websites linked from each landing page
+	// which score at least minLinkScore as a dealership.
+	followLinks  bool
+	minLinkScore float64
+	// insecure also crawls the hosts on certificates which didn't verify.
+	insecure bool
+	// ctURL is the crt.sh compatible search to find new seeds with, if
+	// set, and ctPatterns are the names to search it and ctFiles for.
+	ctURL      string
+	ctPatterns []string
+}
+
+// defaultCTPatterns match the hostnames with a keyword of one of the makes
+// we're interested in, e.g. %subaru%.
+func defaultCTPatterns() []string {
+	out := []string{}
+	for _, knownMake := range getInterestedMakes() {
+		for _, keyword := range dealer.MakeKeywords(knownMake) {
+			out = append(out, discovery.CTPattern(keyword))
+		}
+	}
+
+	return out
+}
+
+// findCTSeeds returns the hosts in the Certificate Transparency results
+// files and search which match the patterns and are allowed by the rules.
+// Files which can't be loaded and searches which fail are logged and skipped;
+// an error is only returned when every one of them failed.
+func findCTSeeds(ctx context.Context, paths discoverPaths, opts discoverOptions) ([]discovery.CTSeed, error) {
+	out := []discovery.CTSeed{}
+	found := sets.NewString()
+	errs := []error{}
+	attempts := 0
+
+	add := func(entries []discovery.CTEntry, source, pattern string) {
+		filter := func(host string) bool {
+			return discovery.MatchCTPattern(pattern, host) && opts.rules.Allowed(host)
+		}
+
+		for _, seed := range discovery.CTSeeds(entries, filter, fmt.Sprintf("%s %s", source, pattern)) {
+			if !found.Has(seed.Hostname) {
+				found.Insert(seed.Hostname)
+				out = append(out, seed)
+			}
+		}
+	}
+
+	for _, path := range paths.ctFiles {
+		attempts++
+		entries, err := discovery.LoadCTEntries(path)
+		if err != nil {
+			logger.Warn("could not load Certificate Transparency results, skipping", "path", path, "error", err)
+			errs = append(errs, err)
+			continue
+		}
 
-	wp := workerpool.New(5)
-	extractWP := workerpool.New(10)
+		for _, pattern := range opts.ctPatterns {
+			add(entries, path, pattern)
+		}
+	}
 
-	outer := func(h DealerHost) func() {
-		return func() {
-			hostSet, respBuf, err := doScrapeDealerWebsite(h.Hostname)
+	if opts.ctURL != "" {
+		search := &discovery.CTSearch{BaseURL: opts.ctURL}
+		for _, pattern := range opts.ctPatterns {
+			attempts++
+			entries, err := search.Search(ctx, pattern)
 			if err != nil {
-				fmt.Println("Skipping:", h.Hostname, "Error:", err)
-				h.Visited = false
-				dealerHostChan <- h
-				return
+				logger.Warn("could not search Certificate Transparency logs, skipping", "url", opts.ctURL, "pattern", pattern, "error", err)
+				errs = append(errs, err)
+				continue
 			}
 
-			h.Visited = true
-			dealerHostChan <- h
-			hostSetChan <- hostSet
+			add(entries, opts.ctURL, pattern)
+		}
+	}
+
+	if attempts != 0 && len(errs) == attempts {
+		return out, fmt.Errorf("every Certificate Transparency source failed: %w", aggError.NewAggregate(errs))
+	}
+
+	return out, nil
+}
+
+// findAllDealers crawls the hosts which haven't been visited yet. Its progress
+// is checkpointed as it goes and the hosts and classified dealers files are
+// only written once the crawl finishes, so a crawl which is interrupted or
+// runs out of time is picked up from the checkpoint the next time it is run.
+func findAllDealers(ctx context.Context, paths discoverPaths, opts discoverOptions) error {
+	hosts, err := loadHostsFile(paths.hosts, paths.dealerURLs)
+	if err != nil {
+		return err
+	}
+
+	printDealerHostStats(hosts)
+
+	dealerResps, err := readClassifiedDealersFileAndFlatten(paths.classified)
+	if err != nil {
+		return err
+	}
 
-			extractWP.Submit(func() {
-				start := time.Now()
+	cp, resuming, err := discovery.LoadCheckpoint(paths.checkpoint)
+	if err != nil {
+		return err
+	}
 
-				dealerResp, err := dealer.GetDealerResponseFromReader(respBuf, h.Hostname)
-				if err != nil {
-					fmt.Println("Skipping extraction for:", h.Hostname)
-				}
+	graph, err := discovery.LoadGraph(paths.graph)
+	if err != nil {
+		return err
+	}
 
-				fmt.Println("Content extraction for", h.Hostname, "took:", time.Since(start))
+	byHostname := map[string]int{}
+	for i, host := range hosts {
+		byHostname[host.Hostname] = i
+	}
 
-				dealerRespChan <- dealerResp
+	addHost := func(h discovery.HostRecord) {
+		if _, ok := byHostname[h.Hostname]; !ok {
+			byHostname[h.Hostname] = len(hosts)
+			hosts = append(hosts, DealerHost{
+				Hostname:    h.Hostname,
+				Visited:     false,
+				Path:        h.Path,
+				Channel:     h.Channel,
+				Certificate: h.Certificate,
+				LinkScore:   h.LinkScore,
+				Source:      h.Source,
 			})
 		}
 	}
 
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		out := sets.NewString()
-
-		known := dealerHostsToSet(hosts)
-
-		for {
-			select {
-			case hostSet, ok := <-hostSetChan:
-				if !ok {
-					close(dealerHostChan)
-					return
-				}
-				for foundHost := range hostSet {
-					if !out.Has(foundHost) && !known.Has(foundHost) {
-						if isInterestedMake(foundHost) {
-							fmt.Println("Found new host:", foundHost)
-							out.Insert(foundHost)
-						} else {
-							fmt.Println("Skipping new host:", foundHost, "Not interested make.")
-						}
-
-						dealerHostChan <- DealerHost{
-							Hostname: foundHost,
-							Visited:  false,
-						}
-					}
-				}
+	logger.Debug("discovery rules", "rules", opts.rules.String())
+
+	crawler := &discovery.Crawler{
+		Filter:             opts.rules.Allowed,
+		LinkFilter:         linkRules(opts.rules).Allowed,
+		Graph:              graph,
+		Concurrency:        5,
+		FollowLinks:        opts.followLinks,
+		MinLinkScore:       opts.minLinkScore,
+		Insecure:           opts.insecure,
+		MaxDepth:           opts.maxDepth,
+		MaxHosts:           opts.maxHosts,
+		MaxDuration:        opts.maxTime,
+		CheckpointPath:     paths.checkpoint,
+		CheckpointInterval: opts.checkpointInterval,
+		OnHost:             addHost,
+		OnVisit: func(v discovery.Visit) {
+			if v.Err != nil {
+				return
 			}
-		}
-	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		dealerResps, err := readClassifiedDealersFileAndFlatten()
-		if err != nil {
-			panic(err)
-		}
-		for {
-			select {
-			case dealerResp, ok := <-dealerRespChan:
-				if !ok {
-					if err := writeClassifiedDealersFile(dealerResps); err != nil {
-						panic(err)
-					}
+			hosts[byHostname[v.Hostname]].Visited = true
+			hosts[byHostname[v.Hostname]].TLS = v.TLS
 
-					return
-				}
-
-				dealerResps = append(dealerResps, dealerResp)
-				/*
-					wp.Submit(func() {
-						mnm := getInterestedMakesAndModels()
-						for key := range mnm {
-							if strings.Contains(dealerResp.SiteURL, key) {
-								_, err := dealer.GetDealerAndInventory(dealerResp, mnm[key])
-								if err != nil {
-									fmt.Println("Could not get inventory for:", mnm[key], dealerResp.SiteURL, err)
-								}
-							}
-						}
-					})
-				*/
+			if v.DealerErr != nil {
+				logger.Warn("skipping extraction", "host", v.Hostname, "platform", v.Dealer.GetPlatform(), "error", v.DealerErr)
+				return
 			}
-		}
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		dealerHosts := []DealerHost{}
-		for {
-			select {
-			case dealerHost, ok := <-dealerHostChan:
-				if !ok {
-					if err := writeHostsFile(dealerHosts); err != nil {
-						panic(err)
-					}
 
-					return
-				}
+			dealerResps = append(dealerResps, *v.Dealer)
+		},
+	}
 
-				dealerHosts = append(dealerHosts, dealerHost)
+	crawler.Known = dealerHostsToSet(hosts).List()
+
+	if resuming {
+		// The hosts found and dealers extracted before the crawl was
+		// stopped are only in the checkpoint.
+		for _, h := range cp.Hosts {
+			addHost(h)
+			if h.Status == discovery.StatusVisited {
+				hosts[byHostname[h.Hostname]].Visited = true
+				hosts[byHostname[h.Hostname]].TLS = h.TLS
 			}
 		}
-	}()
-
-	/*
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case toScrape, ok := <-scrapeChan:
-					if !ok {
-						return
-					}
 
-					wp.Submit(outer(toScrape))
-				}
+		dealerResps = append(dealerResps, cp.Dealers...)
+		crawler.Resume(cp)
+	} else {
+		for _, host := range hosts {
+			if !host.Visited {
+				crawler.Seeds = append(crawler.Seeds, host.Hostname)
 			}
-		}()
+		}
+	}
+
+	// The crawl only needs the Certificate Transparency logs when there is
+	// nothing else to crawl.
+	ctSeeds, err := findCTSeeds(ctx, paths, opts)
+	if err != nil {
+		if !resuming && len(crawler.Seeds) == 0 {
+			return err
+		}
 
-	*/
+		logger.Warn("crawling without new hosts from Certificate Transparency logs", "error", err)
+	}
 
-	for _, host := range hosts {
-		if host.Visited {
-			dealerHostChan <- host
+	// New hosts from the Certificate Transparency logs are crawled as
+	// seeds, remembering where they came from.
+	newCTSeeds := 0
+	for _, seed := range ctSeeds {
+		if _, ok := byHostname[seed.Hostname]; ok {
 			continue
 		}
 
-		if !isInterestedMake(host.Hostname) {
-			fmt.Println("Skipping", host.Hostname, "because it is not an interested make")
-			continue
+		addHost(discovery.HostRecord{
+			Hostname: seed.Hostname,
+			Source:   seed.Source,
+			Path:     []string{seed.Hostname},
+		})
+
+		if crawler.SeedSources == nil {
+			crawler.SeedSources = map[string]string{}
 		}
 
-		wp.Submit(outer(host))
+		crawler.Seeds = append(crawler.Seeds, seed.Hostname)
+		crawler.SeedSources[seed.Hostname] = seed.Source
+		newCTSeeds++
+	}
+
+	if len(ctSeeds) != 0 {
+		logger.Info("found hosts in Certificate Transparency logs", "hosts", len(ctSeeds), "new", newCTSeeds)
+	}
+
+	// Without a checkpoint, a crawl which runs out of time writes what it
+	// has found and its unvisited hosts are crawled the next time instead.
+	err = crawler.Run(ctx)
+	if errors.Is(err, discovery.ErrOutOfTime) && paths.checkpoint != "" {
+		logger.Info("crawl ran out of time, run discover again to carry on", "maxTime", opts.maxTime, "checkpoint", paths.checkpoint)
+		return nil
+	}
 
-		//scrapeChan <- host
+	if err != nil && !errors.Is(err, discovery.ErrOutOfTime) {
+		return fmt.Errorf("crawl interrupted, run discover again to resume from %s: %w", paths.checkpoint, err)
 	}
 
-	wp.StopWait()
-	extractWP.StopWait()
-	close(hostSetChan)
-	close(dealerRespChan)
+	logger.Info("dealer groups", "hosts", len(graph.Hosts()), "groups", len(graph.GroupNames()))
+
+	if err := aggError.NewAggregate([]error{
+		writeClassifiedDealersFile(paths.classified, dealerResps, defaultMinConfidence),
+		writeHostsFile(paths.hosts, hosts),
+		graph.Save(paths.graph),
+	}); err != nil {
+		return err
+	}
+
+	if paths.checkpoint == "" {
+		return nil
+	}
+
+	if err := os.Remove(paths.checkpoint); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
-	wg.Wait()
+	return nil
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cheesesashimi/subiescraper/pkg/discovery"
+	"github.com/cheesesashimi/subiescraper/pkg/logging"
+)
+
+const testCTResults = `[
+	{"id": 1, "common_name": "smithsubaru.com", "name_value": "smithsubaru.com\nsmithtoyota.com"},
+	{"id": 2, "common_name": "jonessubaru.net", "name_value": "jonessubaru.net"}
+]`
+
+// captureLogs sends the command's logs to the returned buffer for the rest
+// of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	l, err := logging.New(buf, "warn", logging.FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := logger
+	logger = l
+	t.Cleanup(func() {
+		logger = prev
+	})
+
+	return buf
+}
+
+func seedHostnames(seeds []discovery.CTSeed) []string {
+	out := []string{}
+	for _, seed := range seeds {
+		out = append(out, seed.Hostname)
+	}
+
+	return out
+}
+
+func TestFindCTSeedsSkipsFailedSources(t *testing.T) {
+	logs := captureLogs(t)
+
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "saved.json")
+	if err := os.WriteFile(saved, []byte(testCTResults), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try again later", http.StatusBadGateway)
+	}))
+	t.Cleanup(srv.Close)
+
+	paths := discoverPaths{ctFiles: []string{filepath.Join(dir, "missing.json"), saved}}
+	opts := discoverOptions{
+		rules:      discovery.RuleSet{Default: discovery.Allow},
+		ctURL:      srv.URL,
+		ctPatterns: []string{"%subaru%"},
+	}
+
+	seeds, err := findCTSeeds(context.Background(), paths, opts)
+	if err != nil {
+		t.Fatalf("expected the failed sources to be skipped, got %v", err)
+	}
+
+	want := []string{"smithsubaru.com", "jonessubaru.net"}
+	if got := seedHostnames(seeds); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected seeds %v from the saved results, got %v", want, got)
+	}
+
+	for _, msg := range []string{"could not load Certificate Transparency results", "could not search Certificate Transparency logs"} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Errorf("expected %q to be logged, got:\n%s", msg, logs.String())
+		}
+	}
+}
+
+func TestFindCTSeedsEverySourceFailed(t *testing.T) {
+	captureLogs(t)
+
+	paths := discoverPaths{ctFiles: []string{filepath.Join(t.TempDir(), "missing.json")}}
+	opts := discoverOptions{
+		rules:      discovery.RuleSet{Default: discovery.Allow},
+		ctPatterns: []string{"%subaru%"},
+	}
+
+	if _, err := findCTSeeds(context.Background(), paths, opts); err == nil {
+		t.Error("expected an error when every source failed")
+	}
+}
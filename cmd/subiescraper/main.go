@@ -1,41 +1,172 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/cheesesashimi/subiescraper/pkg/dealer"
-	"github.com/cheesesashimi/subiescraper/pkg/html"
+	"github.com/cheesesashimi/subiescraper/pkg/discovery"
+	"github.com/cheesesashimi/subiescraper/pkg/logging"
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	outputText   string = "text"
+	outputNDJSON string = "ndjson"
+	outputJSON   string = "json"
+	outputHTML   string = "html"
+)
+
+// defaultModels are the models searched for when --model isn't given. Makes
+// not listed here have their whole inventory searched.
+var defaultModels = map[string][]string{
+	"subaru": {"WRX", "BRZ", "Outback"},
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "subiescraper",
-		Usage: "Scrape Subaru dealer inventory in North America",
-		Flags: []cli.Flag{
+		Usage: "Scrape Subaru (or other make) dealer inventory in North America",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "make",
+				Usage: fmt.Sprintf("What make to look for; needs --locator-file unless it has a built-in dealer locator (one of: %s)", strings.Join(dealer.GetDealerLocatorMakes(), ", ")),
+				Value: "Subaru",
+			},
+			&cli.StringSliceFlag{
+				Name:        "model",
+				Usage:       "What models to look for, can be combined: --model WRX --model BRZ",
+				DefaultText: "WRX, BRZ and Outback for Subaru, every model otherwise",
+			},
+			&cli.StringFlag{
+				Name:  "transmission",
+				Usage: "Only look for vehicles with this transmission, e.g. Manual",
+			},
+			&cli.StringFlag{
+				Name:  "locator-file",
+				Usage: "Find dealers in a JSON file instead of the make's dealer locator, e.g. the classified-dealers.json from dealercerts",
+			},
+			&cli.StringSliceFlag{
+				Name:  "state",
+				Usage: "What states or provinces to scrape, can be combined: --state PA --state ON, or --state all for every one",
+				Value: cli.NewStringSlice("PA"),
+			},
+			&cli.StringSliceFlag{
+				Name:  "region",
+				Usage: fmt.Sprintf("What regions to scrape, can be combined with each other and --state (one of: %s)", strings.Join(dealer.GetRegionGroupNames(), ", ")),
+			},
+			&cli.BoolFlag{
+				Name:  "try-original-url",
+				Usage: "When a dealer's website can't be followed to where it redirects, scrape the URL from the dealer locator instead of skipping it",
+				Value: false,
+			},
+			&cli.IntFlag{
+				Name:  "max-redirects",
+				Usage: "How many redirects to follow from a dealer's website before skipping it",
+				Value: dealer.DefaultMaxRedirects,
+			},
+			&cli.StringFlag{
+				Name:  "dealer-graph",
+				Usage: "Show the dealer group of each dealer from the dealer-graph.json written by dealercerts",
+			},
 			&cli.StringSliceFlag{
-				Name:        "state",
-				Usage:       "What states to scrape, can be combined: --state PA --state OH",
-				DefaultText: "PA",
+				Name:        "output",
+				Usage:       fmt.Sprintf("Where to write results, can be combined: --output ndjson --output html (one of: %s)", strings.Join(getSinkNames(), ", ")),
+				DefaultText: outputText,
 			},
 			&cli.BoolFlag{
 				Name:  "json",
-				Usage: "Write output to JSON file by state (data-<state>.json)",
+				Usage: "Write output to JSON file by state (data-<state>.json), same as --output json",
 				Value: false,
 			},
 			&cli.BoolFlag{
 				Name:  "html",
-				Usage: "Generate an HTML report by state (data-<state>.html)",
+				Usage: "Generate an HTML report by state (index-<state>.html), same as --output html",
 				Value: false,
 			},
-		},
+			&cli.BoolFlag{
+				Name:  "ndjson-per-dealer",
+				Usage: "With --output ndjson, write one object per dealer instead of one per vehicle",
+				Value: false,
+			},
+		}, logging.Flags()...),
 		Action: func(c *cli.Context) error {
-			return queryDealers(c.StringSlice("state"), c.Bool("json"), c.Bool("html"))
+			logger, err := logging.FromContext(c)
+			if err != nil {
+				return err
+			}
+
+			dealer.SetLogger(logger)
+
+			outputs := c.StringSlice("output")
+			if c.Bool("json") {
+				outputs = append(outputs, outputJSON)
+			}
+
+			if c.Bool("html") {
+				outputs = append(outputs, outputHTML)
+			}
+
+			if !c.IsSet("output") {
+				outputs = append(outputs, outputText)
+			}
+
+			if err := checkOutputs(outputs); err != nil {
+				return err
+			}
+
+			sinks, err := newSinks(outputs, sinkOpts{
+				stdout:          os.Stdout,
+				logger:          logger,
+				ndjsonPerDealer: c.Bool("ndjson-per-dealer"),
+			})
+			if err != nil {
+				return err
+			}
+
+			locator, query, err := getLocatorAndQuery(c)
+			if err != nil {
+				return err
+			}
+
+			states, err := getStates(c)
+			if err != nil {
+				return err
+			}
+
+			states, uncovered, err := getCoveredStates(logger, locator, c.StringSlice("state"), states)
+			if err != nil {
+				return err
+			}
+
+			opts := dealer.ByStateOptions{
+				Query:              query,
+				TryOriginalSiteURL: c.Bool("try-original-url"),
+				MaxRedirects:       c.Int("max-redirects"),
+			}
+
+			groups := map[string]string{}
+			if path := c.String("dealer-graph"); path != "" {
+				graph, err := discovery.LoadGraph(path)
+				if err != nil {
+					return err
+				}
+
+				groups = graph.GroupNames()
+			}
+
+			if err := queryDealers(logger, locator, opts, states, groups, sinks); err != nil {
+				return err
+			}
+
+			printUncoveredStates(os.Stderr, locator, uncovered)
+
+			return nil
 		},
 	}
 
@@ -45,96 +176,238 @@ func main() {
 	}
 }
 
-func printCarDetail(td []dealer.TrackingData, carType string) {
-	if len(td) == 0 {
-		fmt.Println("No", carType, "cars")
-		return
+// checkOutputs rejects outputs which both write to stdout, since their output
+// would be interleaved.
+func checkOutputs(outputs []string) error {
+	if containsOutput(outputs, outputText) && containsOutput(outputs, outputNDJSON) {
+		return fmt.Errorf("--output %s and --output %s can't be combined since they both write to stdout", outputText, outputNDJSON)
 	}
 
-	fmt.Println(strings.Title(carType), "Cars:")
-	for _, item := range td {
-		fmt.Printf("- %d %s %s %s (%s) - %s\n", item.ModelYear, item.Make, item.Model, item.Trim, item.ExteriorColor, item.Link)
-	}
+	return nil
 }
 
-func printDealerDetail(d dealer.Dealer) {
-	fmt.Println("Dealer:", d.Dealer.Name, d.Dealer.SiteURL)
-	printCarDetail(d.New.PageInfo.TrackingData, "new")
-	printCarDetail(d.Used.PageInfo.TrackingData, "used")
+func containsOutput(outputs []string, output string) bool {
+	for _, o := range outputs {
+		if o == output {
+			return true
+		}
+	}
+
+	return false
 }
 
-func renderToDisk(dealers []dealer.Dealer, state string) error {
-	filename := fmt.Sprintf("index-%s.html", strings.ToLower(state))
-	fmt.Println("Rendering to", filename)
-	page := html.DealersPage(dealers)
-	return ioutil.WriteFile(filename, []byte(page), 0755)
+// getStates validates --state and --region before anything is scraped. The
+// default state is only used when neither is given.
+func getStates(c *cli.Context) ([]string, error) {
+	states := c.StringSlice("state")
+	if c.IsSet("region") && !c.IsSet("state") {
+		states = nil
+	}
+
+	return dealer.ResolveRegions(states, c.StringSlice("region"))
 }
 
-func jsonToDisk(dealers []dealer.Dealer, state string) error {
-	filename := fmt.Sprintf("data-%s.json", strings.ToLower(state))
-	fmt.Println("Dumping JSON to:", filename)
+// getCoveredStates splits the states into the ones the locator can find
+// dealers in and the ones it can't. States named with --state are an error,
+// while ones from --state all or --region are skipped since the rest of the
+// region can still be scraped.
+func getCoveredStates(logger *slog.Logger, locator dealer.DealerLocator, named, states []string) ([]string, []string, error) {
+	explicit := map[string]bool{}
+	for _, state := range named {
+		if r, ok := dealer.LookupRegion(state); ok {
+			explicit[r.Code] = true
+		}
+	}
 
-	outBytes, err := json.Marshal(dealers)
-	if err != nil {
-		return fmt.Errorf("could not marshal to JSON: %w", err)
+	out := []string{}
+	skipped := []string{}
+	for _, state := range states {
+		if dealer.LocatorCovers(locator, state) {
+			out = append(out, state)
+			continue
+		}
+
+		if explicit[state] {
+			return nil, nil, fmt.Errorf("the %s dealer locator can't find dealers in %s", locator.Name(), state)
+		}
+
+		skipped = append(skipped, state)
+	}
+
+	if len(skipped) != 0 {
+		logger.Warn("skipping states the dealer locator can't find dealers in", "locator", locator.Name(), "states", strings.Join(skipped, ", "))
 	}
 
-	return ioutil.WriteFile(filename, outBytes, 0755)
+	if len(out) == 0 {
+		return nil, nil, fmt.Errorf("the %s dealer locator can't find dealers in any of the given states", locator.Name())
+	}
+
+	return out, skipped, nil
 }
 
-func queryDealers(states []string, toJSON, toHTML bool) error {
-	fmt.Println("Will query for Subarus in:", strings.Join(states, ", "))
+// printUncoveredStates lists the states which were skipped because the
+// locator can't find dealers in them, so they don't go unnoticed in the logs.
+func printUncoveredStates(out io.Writer, locator dealer.DealerLocator, states []string) {
+	if len(states) == 0 {
+		return
+	}
 
-	if toJSON {
-		fmt.Println("Will write results to JSON files")
+	fmt.Fprintf(out, "The following states were skipped since the %s dealer locator doesn't cover them (%d): %s\n", locator.Name(), len(states), strings.Join(states, ", "))
+}
+
+func getLocatorAndQuery(c *cli.Context) (dealer.DealerLocator, dealer.InventoryQuery, error) {
+	query := dealer.InventoryQuery{
+		Make:         c.String("make"),
+		Models:       c.StringSlice("model"),
+		Transmission: c.String("transmission"),
 	}
 
-	if toHTML {
-		fmt.Println("Will write results to HTML files")
+	if !c.IsSet("model") {
+		query.Models = defaultModels[strings.ToLower(query.Make)]
 	}
 
-	type dealerErr struct {
-		dealer dealer.Dealer
-		err    error
+	if path := c.String("locator-file"); path != "" {
+		locator := &dealer.FileLocator{
+			Make: query.Make,
+			Path: path,
+		}
+
+		dealer.RegisterDealerLocator(query.Make, locator)
+		return locator, query, nil
+	}
+
+	locator, err := dealer.GetDealerLocator(query.Make)
+	if err != nil {
+		return nil, query, fmt.Errorf("%w, use --locator-file", err)
 	}
 
+	return locator, query, nil
+}
+
+func queryDealers(logger *slog.Logger, locator dealer.DealerLocator, opts dealer.ByStateOptions, states []string, groups map[string]string, sinks []Sink) error {
+	logger.Info("will query for dealer inventory", "make", opts.Query.Make, "models", strings.Join(opts.Query.Models, ", "), "locator", locator.Name(), "states", strings.Join(states, ", "))
+
 	dealerErrs := []dealerErr{}
 
 	for _, state := range states {
-		fmt.Println("Getting dealers in", state)
+		logger.Info("getting dealers", "state", state)
 		dealers := []dealer.Dealer{}
-		for d := range dealer.ByState(state) {
+		for d := range dealer.ByState(locator, state, opts) {
 			if d.Err != nil {
-				fmt.Println("ERROR:", d.Err, "Skipping...")
+				logger.Error("could not get dealer inventory, skipping", "dealer", d.Dealer.Dealer.Name, "url", d.Dealer.Dealer.SiteURL, "state", state, "stage", d.Stage, "error", d.Err)
 				dealerErrs = append(dealerErrs, dealerErr{
-					dealer: d.Dealer,
-					err:    d.Err,
+					dealer:   d.Dealer,
+					state:    state,
+					stage:    d.Stage,
+					dnsNames: d.DNSNames,
+					err:      d.Err,
 				})
 				continue
 			}
-			printDealerDetail(d.Dealer)
-			dealers = append(dealers, d.Dealer)
-		}
 
-		if toHTML {
-			if err := renderToDisk(dealers, state); err != nil {
-				return fmt.Errorf("could not write dealer HTML to disk: %w", err)
+			d.Dealer.Dealer.DealerGroup = discovery.GroupName(groups, d.Dealer.Dealer.SiteURL)
+
+			for _, sink := range sinks {
+				if err := sink.Dealer(d.Dealer, state); err != nil {
+					return err
+				}
 			}
+
+			logger.Info("got dealer inventory", "dealer", d.Dealer.Dealer.Name, "url", d.Dealer.Dealer.SiteURL, "state", state, "provider", d.Provider, "vehicles", len(d.Vehicles))
+			dealers = append(dealers, d.Dealer)
 		}
 
-		if toJSON {
-			if err := jsonToDisk(dealers, state); err != nil {
-				return fmt.Errorf("could not write dealer JSON to disk: %w", err)
+		for _, sink := range sinks {
+			if err := sink.State(dealers, state); err != nil {
+				return err
 			}
 		}
 	}
 
-	if len(dealerErrs) != 0 {
-		fmt.Println("The following dealers were skipped due to errors:")
-		for _, dErr := range dealerErrs {
-			fmt.Printf("- %s - ERROR: %s\n", dErr.dealer.Dealer.Name, dErr.err)
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			return err
 		}
 	}
 
+	printSkippedDealers(os.Stderr, dealerErrs)
+
 	return nil
 }
+
+type dealerErr struct {
+	dealer   dealer.Dealer
+	state    string
+	stage    dealer.Stage
+	dnsNames []string
+	err      error
+}
+
+func (d dealerErr) name() string {
+	if d.stage == dealer.StageLocate {
+		return fmt.Sprintf("all dealers in %s", d.state)
+	}
+
+	return d.dealer.Dealer.Name
+}
+
+// printSkippedDealers prints the dealers which could not be scraped, split
+// into the ones whose website couldn't be found and the ones whose inventory
+// couldn't be read, then grouped by the kind of error which caused them to be
+// skipped.
+func printSkippedDealers(out io.Writer, dealerErrs []dealerErr) {
+	if len(dealerErrs) == 0 {
+		return
+	}
+
+	discovery := []dealerErr{}
+	inventory := []dealerErr{}
+	for _, dErr := range dealerErrs {
+		if dErr.stage.IsDiscovery() {
+			discovery = append(discovery, dErr)
+		} else {
+			inventory = append(inventory, dErr)
+		}
+	}
+
+	fmt.Fprintln(out, "The following dealers were skipped due to errors:")
+	printSkippedStage(out, "Discovery failures", discovery)
+	printSkippedStage(out, "Inventory failures", inventory)
+}
+
+func printSkippedStage(out io.Writer, title string, dealerErrs []dealerErr) {
+	if len(dealerErrs) == 0 {
+		return
+	}
+
+	byKind := map[string][]dealerErr{}
+	for _, dErr := range dealerErrs {
+		kind := "other"
+		if k := dealer.ErrorKind(dErr.err); k != nil {
+			kind = k.Error()
+		}
+
+		byKind[kind] = append(byKind[kind], dErr)
+	}
+
+	kinds := []string{}
+	for kind := range byKind {
+		kinds = append(kinds, kind)
+	}
+
+	sort.Strings(kinds)
+
+	fmt.Fprintf(out, "%s (%d):\n", title, len(dealerErrs))
+	for _, kind := range kinds {
+		fmt.Fprintf(out, "  %s (%d):\n", kind, len(byKind[kind]))
+		for _, dErr := range byKind[kind] {
+			fmt.Fprintf(out, "  - %s [state: %s] [stage: %s] [platform: %s] - ERROR: %s\n", dErr.name(), dErr.state, dErr.stage, dErr.dealer.Dealer.Platform, dErr.err)
+			if len(dErr.dealer.Dealer.Redirects) != 0 {
+				fmt.Fprintf(out, "    redirects: %s\n", dealer.FormatRedirects(dErr.dealer.Dealer.Redirects))
+			}
+			if len(dErr.dnsNames) != 0 {
+				fmt.Fprintf(out, "    certificate names: %s\n", strings.Join(dErr.dnsNames, ", "))
+			}
+		}
+	}
+}
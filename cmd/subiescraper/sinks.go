@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/cheesesashimi/subiescraper/pkg/dealer"
+	"github.com/cheesesashimi/subiescraper/pkg/html"
+)
+
+// Sink receives the results of a scrape. Dealer is called as soon as each
+// dealer has been scraped, State is called with every dealer once a state is
+// finished and Close is called once at the end of the run.
+type Sink interface {
+	Dealer(d dealer.Dealer, state string) error
+	State(dealers []dealer.Dealer, state string) error
+	Close() error
+}
+
+type sinkOpts struct {
+	stdout          io.Writer
+	logger          *slog.Logger
+	ndjsonPerDealer bool
+}
+
+// sinkFactories maps the values accepted by --output to the sink they enable.
+var sinkFactories = map[string]func(sinkOpts) Sink{
+	outputText: func(opts sinkOpts) Sink {
+		return &textSink{out: opts.stdout}
+	},
+	outputNDJSON: func(opts sinkOpts) Sink {
+		return &ndjsonSink{enc: json.NewEncoder(opts.stdout), perDealer: opts.ndjsonPerDealer}
+	},
+	outputJSON: func(opts sinkOpts) Sink {
+		return &jsonSink{logger: opts.logger}
+	},
+	outputHTML: func(opts sinkOpts) Sink {
+		return &htmlSink{logger: opts.logger}
+	},
+}
+
+func getSinkNames() []string {
+	names := []string{}
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func newSinks(names []string, opts sinkOpts) ([]Sink, error) {
+	sinks := []Sink{}
+	seen := map[string]struct{}{}
+
+	for _, name := range names {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		factory, ok := sinkFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown output %q, must be one of: %s", name, strings.Join(getSinkNames(), ", "))
+		}
+
+		seen[name] = struct{}{}
+		sinks = append(sinks, factory(opts))
+	}
+
+	return sinks, nil
+}
+
+// textSink prints a human-readable summary of each dealer.
+type textSink struct {
+	out io.Writer
+}
+
+func (t *textSink) Dealer(d dealer.Dealer, _ string) error {
+	printDealerDetail(t.out, d)
+	return nil
+}
+
+func (t *textSink) State(_ []dealer.Dealer, _ string) error {
+	return nil
+}
+
+func (t *textSink) Close() error {
+	return nil
+}
+
+func printCarDetail(out io.Writer, vehicles []dealer.Vehicle, carType string) {
+	if len(vehicles) == 0 {
+		fmt.Fprintln(out, "No", carType, "cars")
+		return
+	}
+
+	fmt.Fprintln(out, strings.Title(carType), "Cars:")
+	for _, item := range vehicles {
+		fmt.Fprintf(out, "- %d %s %s %s (%s) - %s\n", item.Year, item.Make, item.Model, item.Trim, item.ExteriorColor, item.Link)
+	}
+}
+
+func printDealerDetail(out io.Writer, d dealer.Dealer) {
+	fmt.Fprintln(out, "Dealer:", d.Dealer.Name, d.Dealer.SiteURL)
+	if d.Dealer.DealerGroup != "" {
+		fmt.Fprintln(out, "Dealer group:", d.Dealer.DealerGroup)
+	}
+	if d.Dealer.OffSiteRedirect {
+		fmt.Fprintln(out, "Redirected to another domain:", dealer.FormatRedirects(d.Dealer.Redirects))
+	}
+	printCarDetail(out, d.VehiclesByCondition(dealer.ConditionNew), "new")
+	printCarDetail(out, d.VehiclesByCondition(dealer.ConditionUsed), "used")
+}
+
+// vehicleRecord is what gets written for each vehicle in NDJSON output.
+type vehicleRecord struct {
+	Dealer      string         `json:"dealer"`
+	DealerURL   string         `json:"dealerUrl"`
+	DealerGroup string         `json:"dealerGroup,omitempty"`
+	State       string         `json:"state"`
+	Condition   string         `json:"condition"`
+	Vehicle     dealer.Vehicle `json:"vehicle"`
+}
+
+// ndjsonSink writes each dealer as soon as it is scraped, either as a single
+// object or as one object per vehicle.
+type ndjsonSink struct {
+	enc       *json.Encoder
+	perDealer bool
+}
+
+func (n *ndjsonSink) Dealer(d dealer.Dealer, state string) error {
+	if n.perDealer {
+		return n.enc.Encode(d)
+	}
+
+	for _, item := range d.Vehicles {
+		err := n.enc.Encode(vehicleRecord{
+			Dealer:      d.Dealer.Name,
+			DealerURL:   d.Dealer.SiteURL,
+			DealerGroup: d.Dealer.DealerGroup,
+			State:       state,
+			Condition:   item.Condition,
+			Vehicle:     item,
+		})
+		if err != nil {
+			return fmt.Errorf("could not write dealer NDJSON: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (n *ndjsonSink) State(_ []dealer.Dealer, _ string) error {
+	return nil
+}
+
+func (n *ndjsonSink) Close() error {
+	return nil
+}
+
+// jsonSink writes every dealer in a state to data-<state>.json.
+type jsonSink struct {
+	logger *slog.Logger
+}
+
+func (j *jsonSink) Dealer(_ dealer.Dealer, _ string) error {
+	return nil
+}
+
+func (j *jsonSink) State(dealers []dealer.Dealer, state string) error {
+	filename := fmt.Sprintf("data-%s.json", strings.ToLower(state))
+	j.logger.Info("dumping JSON", "state", state, "filename", filename)
+
+	outBytes, err := json.Marshal(dealers)
+	if err != nil {
+		return fmt.Errorf("could not marshal to JSON: %w", err)
+	}
+
+	if err := ioutil.WriteFile(filename, outBytes, 0755); err != nil {
+		return fmt.Errorf("could not write dealer JSON to disk: %w", err)
+	}
+
+	return nil
+}
+
+func (j *jsonSink) Close() error {
+	return nil
+}
+
+// htmlSink renders every dealer in a state to index-<state>.html.
+type htmlSink struct {
+	logger *slog.Logger
+}
+
+func (h *htmlSink) Dealer(_ dealer.Dealer, _ string) error {
+	return nil
+}
+
+func (h *htmlSink) State(dealers []dealer.Dealer, state string) error {
+	filename := fmt.Sprintf("index-%s.html", strings.ToLower(state))
+	h.logger.Info("rendering HTML", "state", state, "filename", filename)
+	page := html.DealersPage(dealers)
+	if err := ioutil.WriteFile(filename, []byte(page), 0755); err != nil {
+		return fmt.Errorf("could not write dealer HTML to disk: %w", err)
+	}
+
+	return nil
+}
+
+func (h *htmlSink) Close() error {
+	return nil
+}
@@ -1,12 +1,13 @@
 module github.com/cheesesashimi/subiescraper
 
-go 1.17
+go 1.21
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/gammazero/workerpool v1.1.2
 	github.com/julvo/htmlgo v0.0.0-20200505154053-2e9f4b95a223
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/net v0.0.0-20210916014120-12bc252f5db8
 	k8s.io/apimachinery v0.22.4
 )
 
@@ -16,5 +17,5 @@ require (
 	github.com/gammazero/deque v0.1.0 // indirect
 	github.com/russross/blackfriday/v2 v2.0.1 // indirect
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
-	golang.org/x/net v0.0.0-20210916014120-12bc252f5db8 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
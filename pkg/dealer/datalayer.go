@@ -0,0 +1,75 @@
+package dealer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cheesesashimi/subiescraper/pkg/jsobject"
+)
+
+// ErrNoDataLayer is returned when a page does not assign
+// DDC.dataLayer['dealership'], which every Dealer.com site does.
+var ErrNoDataLayer = errors.New("no DDC.dataLayer['dealership'] found")
+
+var dataLayerAssignment = regexp.MustCompile(`DDC\.dataLayer\s*(?:\[\s*['"]dealership['"]\s*\]|\.dealership)\s*=\s*`)
+
+// GetDataLayerFromDocument finds the DDC.dataLayer['dealership'] object
+// literal in the page's scripts and returns every field assigned in it.
+func GetDataLayerFromDocument(doc *goquery.Document) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	var parseErr error
+
+	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := s.Text()
+
+		loc := dataLayerAssignment.FindStringIndex(text)
+		if loc == nil {
+			return true
+		}
+
+		v, err := jsobject.Parse(text[loc[1]:])
+		if err != nil {
+			parseErr = fmt.Errorf("could not parse DDC.dataLayer['dealership']: %w", err)
+			return false
+		}
+
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			parseErr = fmt.Errorf("DDC.dataLayer['dealership'] is a %T, not an object", v)
+			return false
+		}
+
+		out = obj
+		return false
+	})
+
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	if out == nil {
+		return nil, ErrNoDataLayer
+	}
+
+	return out, nil
+}
+
+// dataLayerString returns the given dataLayer field as a string. Numbers are
+// formatted without a trailing .0 since fields like postalCode are sometimes
+// written without quotes. Expressions, such as getPhone(), are treated as
+// missing so that the field can be filled in from elsewhere on the page.
+func dataLayerString(dataLayer map[string]interface{}, field string) string {
+	switch v := dataLayer[field].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,54 @@
+package dealer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestDataLayerExpressionFallsBack(t *testing.T) {
+	page := `<html><head>
+<script>
+DDC.dataLayer['dealership'] = {
+	dealershipName: 'Smith Subaru',
+	phone: getPhone(),
+	postalCode: 19103,
+};
+</script>
+<script type="application/ld+json">
+{"@type": "AutoDealer", "name": "Smith Subaru of Philadelphia", "telephone": "215-555-0100"}
+</script>
+</head></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataLayer, err := GetDataLayerFromDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dataLayerString(dataLayer, "phone"); got != "" {
+		t.Errorf("expected the phone expression to be treated as missing, got %q", got)
+	}
+
+	if got := dataLayerString(dataLayer, "postalCode"); got != "19103" {
+		t.Errorf("expected postalCode 19103, got %q", got)
+	}
+
+	dr := DealerResponse{}
+	m := &metadataExtractor{dr: &dr}
+	m.fromDataLayer(dataLayer)
+	m.fromJSONLD(doc)
+
+	if dr.Name != "Smith Subaru" || dr.FieldSources["name"] != SourceDataLayer {
+		t.Errorf("expected the name from the dataLayer, got %q from %q", dr.Name, dr.FieldSources["name"])
+	}
+
+	if dr.PhoneNumber != "215-555-0100" || dr.FieldSources["phoneNumber"] != SourceJSONLD {
+		t.Errorf("expected the phone number from JSON-LD, got %q from %q", dr.PhoneNumber, dr.FieldSources["phoneNumber"])
+	}
+}
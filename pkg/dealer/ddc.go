@@ -0,0 +1,395 @@
+package dealer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	aggError "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	newCarPath  string = "/apis/widget/INVENTORY_LISTING_DEFAULT_AUTO_NEW:inventory-data-bus1/getInventory"
+	usedCarPath string = "/apis/widget/INVENTORY_LISTING_DEFAULT_AUTO_USED:inventory-data-bus1/getInventory"
+)
+
+// ddcInventoryPages are the inventory pages whose markup is searched for the
+// inventory widgets a dealer actually uses, along with the condition of the
+// vehicles each one lists. An empty condition means both new and used.
+var ddcInventoryPages = []ddcEndpoint{
+	{Path: "/new-inventory/index.htm", Condition: ConditionNew},
+	{Path: "/used-inventory/index.htm", Condition: ConditionUsed},
+	{Path: "/certified-inventory/index.htm", Condition: ConditionUsed},
+	{Path: "/all-inventory/index.htm", Condition: ""},
+}
+
+// The default widget endpoints, used for the conditions discovery doesn't find
+// a widget for.
+var ddcDefaultEndpoints = []ddcEndpoint{
+	{Path: newCarPath, Condition: ConditionNew},
+	{Path: usedCarPath, Condition: ConditionUsed},
+}
+
+var (
+	ddcGetInventoryPath = regexp.MustCompile(`/apis/widget/(INVENTORY_LISTING_[A-Z0-9_]+:[A-Za-z0-9_\-]+)/getInventory`)
+	ddcWidgetID         = regexp.MustCompile(`INVENTORY_LISTING_[A-Z0-9_]+:inventory-data-bus\d+`)
+)
+
+// ddcEndpoint is a getInventory path and the condition of the vehicles it
+// returns.
+type ddcEndpoint struct {
+	Path      string
+	Condition string
+}
+
+// DDCProvider gets inventory from the Dealer.com inventory widget API. The
+// widget endpoints are discovered from each dealer's inventory pages the first
+// time the dealer is queried and cached by host.
+type DDCProvider struct {
+	// Client is used for every request, http.DefaultClient if nil.
+	Client *http.Client
+
+	mu        sync.Mutex
+	endpoints map[string][]ddcEndpoint
+}
+
+func (p *DDCProvider) Name() string {
+	return string(PlatformDealerCom)
+}
+
+func (p *DDCProvider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (p *DDCProvider) GetInventory(d DealerResponse, query InventoryQuery) ([]Vehicle, error) {
+	siteURL, err := url.Parse(d.SiteURL)
+	if err != nil {
+		return nil, newURLError(d.Name, d.SiteURL, err)
+	}
+
+	endpoints := p.getEndpoints(d, siteURL)
+	inventoryQuery := query.ddcValues()
+
+	var wg sync.WaitGroup
+	wg.Add(len(endpoints))
+
+	inventories := make([]InventoryResponse, len(endpoints))
+	errs := make([]error, len(endpoints))
+
+	for i, endpoint := range endpoints {
+		go func(i int, endpoint ddcEndpoint) {
+			defer wg.Done()
+			inventories[i], errs[i] = p.getInventoryFromPath(d, endpoint.Path, inventoryQuery)
+		}(i, endpoint)
+	}
+
+	wg.Wait()
+
+	out := []Vehicle{}
+	aggErrs := []error{}
+	seen := map[string]struct{}{}
+
+	for i, endpoint := range endpoints {
+		if errs[i] != nil {
+			condition := endpoint.Condition
+			if condition == "" {
+				condition = "all"
+			}
+
+			aggErrs = append(aggErrs, fmt.Errorf("could not get %s inventory: %w", condition, errs[i]))
+			continue
+		}
+
+		for _, v := range ddcVehicles(inventories[i], endpoint.Condition) {
+			// The same vehicle can be listed by more than one widget,
+			// e.g. the used and certified ones.
+			if v.VIN != "" {
+				if _, ok := seen[v.VIN]; ok {
+					continue
+				}
+				seen[v.VIN] = struct{}{}
+			}
+
+			out = append(out, v)
+		}
+	}
+
+	if len(aggErrs) == len(endpoints) {
+		return out, aggError.NewAggregate(aggErrs)
+	}
+
+	// Keep the conditions which could be fetched rather than failing the
+	// whole dealer.
+	for _, err := range aggErrs {
+		logger.Warn("could not get part of dealer inventory", "dealer", d.Name, "url", d.SiteURL, "provider", p.Name(), "error", err)
+	}
+
+	return out, nil
+}
+
+// getEndpoints returns the cached widget endpoints for the dealer's host,
+// discovering them if this is the first time we've seen it. Conditions which
+// no widget was found for use the default endpoints. Those aren't cached, so
+// the next query tries to discover the real ones again.
+func (p *DDCProvider) getEndpoints(d DealerResponse, siteURL *url.URL) []ddcEndpoint {
+	host := strings.ToLower(siteURL.Host)
+
+	p.mu.Lock()
+	endpoints, ok := p.endpoints[host]
+	p.mu.Unlock()
+
+	if ok {
+		return endpoints
+	}
+
+	discovered := p.discoverEndpoints(d, siteURL)
+	endpoints, defaulted := withDefaultEndpoints(discovered)
+
+	if len(defaulted) != 0 {
+		logger.Debug("could not discover every inventory widget, using the defaults", "dealer", d.Name, "host", host, "discovered", len(discovered), "defaulted", strings.Join(defaulted, ", "))
+		return endpoints
+	}
+
+	logger.Debug("discovered inventory widgets", "dealer", d.Name, "host", host, "endpoints", len(endpoints))
+
+	p.mu.Lock()
+	if p.endpoints == nil {
+		p.endpoints = map[string][]ddcEndpoint{}
+	}
+	p.endpoints[host] = endpoints
+	p.mu.Unlock()
+
+	return endpoints
+}
+
+// withDefaultEndpoints adds the default endpoint for each condition none of
+// the endpoints cover and returns which conditions those were. An endpoint
+// without a condition covers both.
+func withDefaultEndpoints(endpoints []ddcEndpoint) ([]ddcEndpoint, []string) {
+	covered := map[string]bool{}
+	for _, endpoint := range endpoints {
+		if endpoint.Condition == "" {
+			covered[ConditionNew] = true
+			covered[ConditionUsed] = true
+		}
+
+		covered[endpoint.Condition] = true
+	}
+
+	out := append([]ddcEndpoint{}, endpoints...)
+	defaulted := []string{}
+
+	for _, endpoint := range ddcDefaultEndpoints {
+		if !covered[endpoint.Condition] {
+			out = append(out, endpoint)
+			defaulted = append(defaulted, endpoint.Condition)
+		}
+	}
+
+	return out, defaulted
+}
+
+// discoverEndpoints reads the widget IDs and getInventory URLs out of the
+// dealer's inventory pages. The new and used pages are preferred; the
+// certified and all-inventory pages are only used for whatever those don't
+// cover.
+func (p *DDCProvider) discoverEndpoints(d DealerResponse, siteURL *url.URL) []ddcEndpoint {
+	out := []ddcEndpoint{}
+	seen := map[string]struct{}{}
+	covered := map[string]bool{}
+
+	for _, page := range ddcInventoryPages {
+		if page.Condition == "" && (covered[ConditionNew] || covered[ConditionUsed]) {
+			continue
+		}
+
+		pageURL := siteURL.ResolveReference(&url.URL{Path: page.Path})
+
+		body, _, err := fetchPage(p.client(), d.Name, pageURL.String())
+		if err != nil {
+			logger.Debug("could not fetch inventory page", "dealer", d.Name, "url", pageURL.String(), "error", err)
+			continue
+		}
+
+		for _, path := range findDDCInventoryPaths(string(body)) {
+			if _, ok := seen[path]; ok {
+				continue
+			}
+
+			seen[path] = struct{}{}
+
+			condition := ddcWidgetCondition(path, page.Condition)
+			out = append(out, ddcEndpoint{Path: path, Condition: condition})
+			covered[condition] = true
+		}
+	}
+
+	return out
+}
+
+// findDDCInventoryPaths returns the getInventory paths referenced by an
+// inventory page, either directly or by their widget ID.
+func findDDCInventoryPaths(page string) []string {
+	out := []string{}
+	seen := map[string]struct{}{}
+
+	add := func(widgetID string) {
+		path := fmt.Sprintf("/apis/widget/%s/getInventory", widgetID)
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			out = append(out, path)
+		}
+	}
+
+	for _, match := range ddcGetInventoryPath.FindAllStringSubmatch(page, -1) {
+		add(match[1])
+	}
+
+	for _, match := range ddcWidgetID.FindAllString(page, -1) {
+		add(match)
+	}
+
+	return out
+}
+
+// ddcWidgetCondition works out which vehicles a widget lists from its ID,
+// e.g. INVENTORY_LISTING_DEFAULT_AUTO_NEW, falling back to the condition of
+// the page it was found on.
+func ddcWidgetCondition(path, pageCondition string) string {
+	switch {
+	case strings.Contains(path, "_NEW"):
+		return ConditionNew
+	case strings.Contains(path, "_USED"), strings.Contains(path, "_CERTIFIED"), strings.Contains(path, "_CPO"):
+		return ConditionUsed
+	case strings.Contains(path, "_ALL"):
+		return ""
+	default:
+		return pageCondition
+	}
+}
+
+// ddcValues converts the query into the parameters the DDC widget API takes.
+func (q InventoryQuery) ddcValues() url.Values {
+	out := url.Values{}
+
+	if q.Make != "" {
+		out["make"] = []string{q.Make}
+	}
+
+	if len(q.Models) != 0 {
+		out["model"] = q.Models
+	}
+
+	if q.Transmission != "" {
+		out["normalTransmission"] = []string{q.Transmission}
+	}
+
+	return out
+}
+
+// ddcVehicles converts the widget's tracking data into Vehicles. condition is
+// used for any vehicle which doesn't say whether it's new or used.
+func ddcVehicles(inventory InventoryResponse, condition string) []Vehicle {
+	out := []Vehicle{}
+
+	for _, item := range inventory.PageInfo.TrackingData {
+		condition := condition
+		if item.NewOrUsed != "" {
+			condition = normalizeCondition(item.NewOrUsed)
+		}
+
+		out = append(out, Vehicle{
+			VIN:           item.Vin,
+			Condition:     condition,
+			Certified:     item.Certified,
+			Year:          item.ModelYear,
+			Make:          item.Make,
+			Model:         item.Model,
+			Trim:          item.Trim,
+			BodyStyle:     item.BodyStyle,
+			ExteriorColor: item.ExteriorColor,
+			InteriorColor: item.InteriorColor,
+			Transmission:  item.Transmission,
+			MSRP:          parsePrice(item.Msrp),
+			Price:         parsePrice(item.InternetPrice),
+			Link:          item.Link,
+			Provider:      string(PlatformDealerCom),
+			Confidence:    ConfidenceAPI,
+		})
+	}
+
+	return out
+}
+
+func (p *DDCProvider) getInventoryFromPath(d DealerResponse, inventoryPath string, inventoryQuery url.Values) (InventoryResponse, error) {
+	out := InventoryResponse{}
+
+	u, err := url.Parse(d.SiteURL)
+	if err != nil {
+		return out, newURLError(d.Name, d.SiteURL, err)
+	}
+
+	u.Path = inventoryPath
+	u.RawQuery = inventoryQuery.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return out, newURLError(d.Name, u.String(), err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	start := time.Now()
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return out, newRequestError(d.Name, u.String(), err)
+	}
+
+	defer resp.Body.Close()
+
+	logger.Debug("fetched inventory", "dealer", d.Name, "host", u.Host, "path", inventoryPath, "status", resp.StatusCode, "duration", time.Since(start))
+
+	if resp.StatusCode != http.StatusOK {
+		return out, newStatusError(d.Name, u.String(), resp.StatusCode, ErrNotDealerCom)
+	}
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return out, newRequestError(d.Name, u.String(), err)
+	}
+
+	if err := json.Unmarshal(respBytes, &out); err != nil {
+		return out, newSchemaError(d.Name, u.String(), err)
+	}
+
+	for i, item := range out.Inventory {
+		out.Inventory[i].Link = getDirectLink(resp.Request.URL, item.Link)
+	}
+
+	for i, item := range out.PageInfo.TrackingData {
+		out.PageInfo.TrackingData[i].Link = getDirectLink(resp.Request.URL, item.Link)
+	}
+
+	return out, nil
+}
+
+func getDirectLink(respURL *url.URL, link string) string {
+	u := url.URL{
+		Scheme: respURL.Scheme,
+		Host:   respURL.Host,
+		Path:   link,
+	}
+
+	return u.String()
+}
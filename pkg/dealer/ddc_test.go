@@ -0,0 +1,77 @@
+package dealer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDDCProviderGetEndpoints(t *testing.T) {
+	pages := map[string]string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	siteURL, _ := url.Parse(srv.URL)
+	d := DealerResponse{Name: "Smith Subaru", SiteURL: srv.URL}
+	p := &DDCProvider{Client: srv.Client()}
+
+	// Only the used widget can be discovered at first, so the new one is
+	// filled in from the defaults and nothing is cached.
+	usedWidget := "/apis/widget/INVENTORY_LISTING_GRID_AUTO_USED:inventory-data-bus2/getInventory"
+	pages["/used-inventory/index.htm"] = `<div data-widget-id="INVENTORY_LISTING_GRID_AUTO_USED:inventory-data-bus2"></div>`
+
+	want := []ddcEndpoint{
+		{Path: usedWidget, Condition: ConditionUsed},
+		{Path: newCarPath, Condition: ConditionNew},
+	}
+
+	if got := p.getEndpoints(d, siteURL); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if _, ok := p.endpoints[siteURL.Host]; ok {
+		t.Fatal("expected endpoints filled in from the defaults not to be cached")
+	}
+
+	// Once the new widget can be discovered too, the endpoints are cached.
+	newWidget := "/apis/widget/INVENTORY_LISTING_GRID_AUTO_NEW:inventory-data-bus2/getInventory"
+	pages["/new-inventory/index.htm"] = `<script>fetch("` + newWidget + `")</script>`
+
+	want = []ddcEndpoint{
+		{Path: newWidget, Condition: ConditionNew},
+		{Path: usedWidget, Condition: ConditionUsed},
+	}
+
+	if got := p.getEndpoints(d, siteURL); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if got := p.endpoints[siteURL.Host]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected discovered endpoints to be cached, got %+v", got)
+	}
+}
+
+func TestWithDefaultEndpoints(t *testing.T) {
+	all := ddcEndpoint{Path: "/apis/widget/INVENTORY_LISTING_DEFAULT_AUTO_ALL:inventory-data-bus1/getInventory"}
+
+	got, defaulted := withDefaultEndpoints([]ddcEndpoint{all})
+	if !reflect.DeepEqual(got, []ddcEndpoint{all}) || len(defaulted) != 0 {
+		t.Errorf("expected an all-inventory widget to cover both conditions, got %+v and defaults for %v", got, defaulted)
+	}
+
+	got, defaulted = withDefaultEndpoints(nil)
+	if !reflect.DeepEqual(got, ddcDefaultEndpoints) || !reflect.DeepEqual(defaulted, []string{ConditionNew, ConditionUsed}) {
+		t.Errorf("expected the default endpoints, got %+v and defaults for %v", got, defaulted)
+	}
+}
@@ -0,0 +1,343 @@
+package dealer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheesesashimi/subiescraper/pkg/jsobject"
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+// ErrNoSearchConfig is returned when a DealerInspire landing page does not
+// contain the configuration for its inventory search.
+var ErrNoSearchConfig = errors.New("no inventory search configuration found")
+
+const (
+	// dealerInspireHitsPerPage is the most hits Algolia returns per request.
+	dealerInspireHitsPerPage int = 100
+	// dealerInspireMaxPages stops us from paging forever through a huge
+	// dealer group index.
+	dealerInspireMaxPages int = 20
+)
+
+// DealerInspireProvider gets inventory from the Algolia-style search index
+// that DealerInspire sites configure on their landing page.
+type DealerInspireProvider struct {
+	// Client is used for every request, http.DefaultClient if nil.
+	Client *http.Client
+	// SearchBaseURL overrides the search endpoint, which is normally
+	// https://<app id>-dsn.algolia.net. It is used to replay recorded
+	// responses.
+	SearchBaseURL string
+}
+
+func (p *DealerInspireProvider) Name() string {
+	return string(PlatformDealerInspire)
+}
+
+func (p *DealerInspireProvider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (p *DealerInspireProvider) GetInventory(d DealerResponse, query InventoryQuery) ([]Vehicle, error) {
+	page, pageURL, err := fetchPage(p.client(), d.Name, d.SiteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := findSearchConfig(string(page))
+	if err != nil {
+		return nil, newSchemaError(d.Name, pageURL.String(), err)
+	}
+
+	out := []Vehicle{}
+	skipped := 0
+
+	for pageNum := 0; pageNum < dealerInspireMaxPages; pageNum++ {
+		result, err := p.search(d, config, query, pageNum)
+		if err != nil {
+			return out, err
+		}
+
+		for _, hit := range result.Hits {
+			v := dealerInspireVehicle(hit, pageURL)
+			if !sameSite(v.Link, pageURL) {
+				skipped++
+				continue
+			}
+
+			out = append(out, v)
+		}
+
+		if pageNum+1 >= result.NbPages {
+			break
+		}
+	}
+
+	if skipped != 0 {
+		logger.Debug("skipped other dealers' vehicles in shared DealerInspire index", "dealer", d.Name, "index", config.Index, "skipped", skipped)
+	}
+
+	return out, nil
+}
+
+// sameSite is true if link is on the same registrable domain as the dealer's
+// page, or has no host of its own. Dealer groups often share one search
+// index between all of their stores, so hits linking elsewhere belong to
+// another dealer.
+func sameSite(link string, pageURL *url.URL) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return true
+	}
+
+	linkDomain, err := utils.RegistrableDomain(u.Host)
+	if err != nil {
+		return false
+	}
+
+	pageDomain, err := utils.RegistrableDomain(pageURL.Host)
+	if err != nil {
+		return false
+	}
+
+	return linkDomain == pageDomain
+}
+
+// searchConfig is what's needed to query a DealerInspire inventory index.
+type searchConfig struct {
+	AppID  string
+	APIKey string
+	Index  string
+}
+
+// The variables DealerInspire assigns its search configuration to.
+var searchConfigAssignment = regexp.MustCompile(`(?:inventoryLightningSettings|algoliaSettings|algoliaConfig|DealerInspireAlgolia)\s*=\s*`)
+
+// When the configuration isn't assigned to a variable we know about, look for
+// the individual keys anywhere in the page.
+var (
+	searchAppIDPattern  = regexp.MustCompile(`["']?(?:appId|applicationId|app_id|algolia_app_id)["']?\s*[:=]\s*["']([A-Za-z0-9]{6,})["']`)
+	searchAPIKeyPattern = regexp.MustCompile(`["']?(?:apiKeySearch|searchApiKey|search_api_key|apiKey|api_key|algolia_search_key)["']?\s*[:=]\s*["']([A-Za-z0-9]{16,})["']`)
+	searchIndexPattern  = regexp.MustCompile(`["']?(?:inventoryIndex|inventory_index|indexName|index_name)["']?\s*[:=]\s*["']([A-Za-z0-9_\-.]+)["']`)
+)
+
+func findSearchConfig(page string) (searchConfig, error) {
+	for _, loc := range searchConfigAssignment.FindAllStringIndex(page, -1) {
+		v, err := jsobject.Parse(page[loc[1]:])
+		if err != nil {
+			continue
+		}
+
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		config := searchConfig{
+			AppID:  firstDataLayerString(obj, "appId", "applicationId", "app_id"),
+			APIKey: firstDataLayerString(obj, "apiKeySearch", "searchApiKey", "search_api_key", "apiKey", "api_key"),
+			Index:  firstDataLayerString(obj, "inventoryIndex", "inventory_index", "indexName", "index_name"),
+		}
+
+		if config.valid() {
+			return config, nil
+		}
+	}
+
+	config := searchConfig{
+		AppID:  firstSubmatch(searchAppIDPattern, page),
+		APIKey: firstSubmatch(searchAPIKeyPattern, page),
+		Index:  firstSubmatch(searchIndexPattern, page),
+	}
+
+	if config.valid() {
+		return config, nil
+	}
+
+	return config, ErrNoSearchConfig
+}
+
+func (s searchConfig) valid() bool {
+	return s.AppID != "" && s.APIKey != "" && s.Index != ""
+}
+
+func firstDataLayerString(obj map[string]interface{}, fields ...string) string {
+	for _, field := range fields {
+		if v := dataLayerString(obj, field); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func firstSubmatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+// facetFilters converts the query into Algolia facet filters. Filters in the
+// same inner list are ORed together and the lists are ANDed.
+func (q InventoryQuery) facetFilters() [][]string {
+	out := [][]string{}
+
+	if q.Make != "" {
+		out = append(out, []string{"make:" + q.Make})
+	}
+
+	if len(q.Models) != 0 {
+		models := []string{}
+		for _, model := range q.Models {
+			models = append(models, "model:"+model)
+		}
+		out = append(out, models)
+	}
+
+	if q.Transmission != "" {
+		out = append(out, []string{"transmission:" + q.Transmission})
+	}
+
+	return out
+}
+
+type dealerInspireSearchResult struct {
+	Hits    []map[string]interface{} `json:"hits"`
+	NbHits  int                      `json:"nbHits"`
+	Page    int                      `json:"page"`
+	NbPages int                      `json:"nbPages"`
+}
+
+func (p *DealerInspireProvider) search(d DealerResponse, config searchConfig, query InventoryQuery, pageNum int) (dealerInspireSearchResult, error) {
+	out := dealerInspireSearchResult{}
+
+	baseURL := p.SearchBaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s-dsn.algolia.net", strings.ToLower(config.AppID))
+	}
+
+	searchURL := fmt.Sprintf("%s/1/indexes/%s/query", strings.TrimRight(baseURL, "/"), url.PathEscape(config.Index))
+
+	facetFilters, err := json.Marshal(query.facetFilters())
+	if err != nil {
+		return out, newSchemaError(d.Name, searchURL, err)
+	}
+
+	params := url.Values{
+		"query":        []string{""},
+		"hitsPerPage":  []string{strconv.Itoa(dealerInspireHitsPerPage)},
+		"page":         []string{strconv.Itoa(pageNum)},
+		"facetFilters": []string{string(facetFilters)},
+	}
+
+	reqBody, err := json.Marshal(map[string]string{"params": params.Encode()})
+	if err != nil {
+		return out, newSchemaError(d.Name, searchURL, err)
+	}
+
+	req, err := http.NewRequest("POST", searchURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return out, newURLError(d.Name, searchURL, err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Algolia-Application-Id", config.AppID)
+	req.Header.Set("X-Algolia-API-Key", config.APIKey)
+
+	start := time.Now()
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return out, newRequestError(d.Name, searchURL, err)
+	}
+
+	defer resp.Body.Close()
+
+	logger.Debug("searched DealerInspire inventory", "dealer", d.Name, "index", config.Index, "page", pageNum, "status", resp.StatusCode, "duration", time.Since(start))
+
+	if resp.StatusCode != http.StatusOK {
+		return out, newStatusError(d.Name, searchURL, resp.StatusCode, ErrHTTPStatus)
+	}
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return out, newRequestError(d.Name, searchURL, err)
+	}
+
+	if err := json.Unmarshal(respBytes, &out); err != nil {
+		return out, newSchemaError(d.Name, searchURL, err)
+	}
+
+	return out, nil
+}
+
+// dealerInspireVehicle maps a search hit to a Vehicle. Field names vary a bit
+// between DealerInspire sites, so several are tried for each value.
+func dealerInspireVehicle(hit map[string]interface{}, pageURL *url.URL) Vehicle {
+	str := func(fields ...string) string {
+		for _, field := range fields {
+			if v := jsonString(hit[field]); v != "" {
+				return v
+			}
+		}
+
+		return ""
+	}
+
+	year, _ := strconv.Atoi(str("year", "model_year"))
+
+	v := Vehicle{
+		VIN:           str("vin"),
+		Condition:     normalizeCondition(str("type", "condition", "new_used")),
+		Year:          year,
+		Make:          str("make"),
+		Model:         str("model"),
+		Trim:          str("trim"),
+		BodyStyle:     str("body", "body_style", "bodystyle"),
+		ExteriorColor: str("ext_color", "exterior_color", "ext_color_generic"),
+		InteriorColor: str("int_color", "interior_color"),
+		Transmission:  str("transmission", "transmission_description"),
+		MSRP:          parsePrice(str("msrp")),
+		Price:         parsePrice(str("our_price", "price", "sale_price", "internet_price")),
+		Link:          str("link", "url"),
+		Provider:      string(PlatformDealerInspire),
+		Confidence:    ConfidenceAPI,
+	}
+
+	switch certified := hit["certified"].(type) {
+	case bool:
+		v.Certified = certified
+	case string:
+		v.Certified = certified == "1" || strings.EqualFold(certified, "true") || strings.EqualFold(certified, "yes")
+	case float64:
+		v.Certified = certified != 0
+	}
+
+	if strings.Contains(strings.ToLower(str("type")), "certified") {
+		v.Certified = true
+	}
+
+	// Links are sometimes relative to the dealer's site.
+	if link, err := url.Parse(v.Link); err == nil && v.Link != "" && !link.IsAbs() {
+		v.Link = pageURL.ResolveReference(link).String()
+	}
+
+	return v
+}
@@ -0,0 +1,208 @@
+package dealer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// newFixtureClient returns a client which sends every request to srv,
+// whatever host it is for, so that fixtures can use real dealer URLs.
+func newFixtureClient(srv *httptest.Server) *http.Client {
+	addr := srv.Listener.Addr().String()
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// dealerInspireServer serves the landing page and search result fixtures
+// and records the search requests it gets.
+type dealerInspireServer struct {
+	t        *testing.T
+	searches []url.Values
+}
+
+func (s *dealerInspireServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Write(readFixture(s.t, "dealerinspire/landing.html"))
+	case "/1/indexes/smithsubaru_production_inventory/query":
+		if r.Method != "POST" || r.Header.Get("X-Algolia-API-Key") != "179608f32563367799314290254e3e44" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		body := map[string]string{}
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		params, err := url.ParseQuery(body["params"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.searches = append(s.searches, params)
+		w.Write(readFixture(s.t, "dealerinspire/search-page-"+params.Get("page")+".json"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDealerInspireProviderGetInventory(t *testing.T) {
+	handler := &dealerInspireServer{t: t}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	p := &DealerInspireProvider{
+		Client:        newFixtureClient(srv),
+		SearchBaseURL: "http://sewjn80htn-dsn.algolia.net",
+	}
+
+	d := DealerResponse{
+		Name:    "Smith Subaru",
+		SiteURL: "http://www.smithsubaru.com/",
+	}
+
+	vehicles, err := p.GetInventory(d, InventoryQuery{Make: "Subaru", Models: []string{"WRX", "Outback"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.searches) != 2 {
+		t.Fatalf("expected both pages to be searched, got %d searches", len(handler.searches))
+	}
+
+	for i, params := range handler.searches {
+		if got := params.Get("page"); got != strconv.Itoa(i) {
+			t.Errorf("search %d: expected page %d, got %s", i, i, got)
+		}
+	}
+
+	wantFilters := `[["make:Subaru"],["model:WRX","model:Outback"]]`
+	if got := handler.searches[0].Get("facetFilters"); got != wantFilters {
+		t.Errorf("expected facet filters %s, got %s", wantFilters, got)
+	}
+
+	// The Outback on the last page belongs to another dealer in the same
+	// index.
+	wantVINs := []string{"4S4BTGND0R3100001", "JF1VBAF67P9800002", "JF1ZDBE16N9700003", "JF1VBAH60M9500004"}
+	gotVINs := []string{}
+	for _, v := range vehicles {
+		gotVINs = append(gotVINs, v.VIN)
+	}
+
+	if !reflect.DeepEqual(gotVINs, wantVINs) {
+		t.Fatalf("expected vehicles %v, got %v", wantVINs, gotVINs)
+	}
+
+	want := Vehicle{
+		VIN:           "4S4BTGND0R3100001",
+		Condition:     ConditionNew,
+		Year:          2024,
+		Make:          "Subaru",
+		Model:         "Outback",
+		Trim:          "Touring XT",
+		BodyStyle:     "SUV",
+		ExteriorColor: "Autumn Green Metallic",
+		InteriorColor: "Java Brown",
+		Transmission:  "Lineartronic CVT",
+		MSRP:          43842,
+		Price:         42380,
+		Link:          "http://www.smithsubaru.com/inventory/new-2024-subaru-outback-touring-xt-4s4btgnd0r3100001/",
+		Provider:      string(PlatformDealerInspire),
+		Confidence:    ConfidenceAPI,
+	}
+
+	if !reflect.DeepEqual(vehicles[0], want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, vehicles[0])
+	}
+
+	if !vehicles[2].Certified {
+		t.Errorf("expected %s to be certified", vehicles[2].VIN)
+	}
+
+	dealer := Dealer{Vehicles: vehicles}
+
+	if got := len(dealer.VehiclesByCondition(ConditionNew)); got != 2 {
+		t.Errorf("expected 2 new vehicles, got %d", got)
+	}
+
+	if got := len(dealer.VehiclesByCondition(ConditionUsed)); got != 2 {
+		t.Errorf("expected 2 used vehicles, got %d", got)
+	}
+}
+
+func TestDealerInspireProviderNoSearchConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>No inventory here</body></html>"))
+	}))
+	defer srv.Close()
+
+	p := &DealerInspireProvider{Client: srv.Client()}
+
+	_, err := p.GetInventory(DealerResponse{SiteURL: srv.URL}, InventoryQuery{Make: "Subaru"})
+	if ErrorKind(err) != ErrSchemaMismatch {
+		t.Fatalf("expected a schema mismatch, got %v", err)
+	}
+}
+
+func TestFindSearchConfig(t *testing.T) {
+	testCases := []struct {
+		name string
+		page string
+		want searchConfig
+	}{
+		{
+			name: "settings object",
+			page: string(readFixture(t, "dealerinspire/landing.html")),
+			want: searchConfig{AppID: "SEWJN80HTN", APIKey: "179608f32563367799314290254e3e44", Index: "smithsubaru_production_inventory"},
+		},
+		{
+			name: "loose keys",
+			page: `<script>window.di = {app_id: 'ABCDEF1234', search_api_key: '0123456789abcdef0123', index_name: 'group_inventory'};</script>`,
+			want: searchConfig{AppID: "ABCDEF1234", APIKey: "0123456789abcdef0123", Index: "group_inventory"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := findSearchConfig(testCase.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != testCase.want {
+				t.Errorf("expected %+v, got %+v", testCase.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package dealer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Sentinel errors describing why fetching from a dealer failed. Every error
+// returned from this package while talking to a dealer or a dealer locator
+// wraps exactly one of these, so callers can use errors.Is to tell them apart.
+var (
+	ErrNotDealerCom   = errors.New("not a Dealer.com site")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrDNS            = errors.New("DNS failure")
+	ErrNetwork        = errors.New("network failure")
+	ErrHTTPStatus     = errors.New("unexpected HTTP status")
+	ErrSchemaMismatch = errors.New("schema mismatch")
+
+	ErrRedirectLoop     = errors.New("redirect loop")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrParkedDomain     = errors.New("parked domain")
+
+	ErrInvalidURL = errors.New("invalid URL")
+)
+
+// errorKinds is the order in which ErrorKind checks the sentinel errors.
+var errorKinds = []error{
+	ErrNotDealerCom,
+	ErrRateLimited,
+	ErrDNS,
+	ErrNetwork,
+	ErrHTTPStatus,
+	ErrSchemaMismatch,
+	ErrRedirectLoop,
+	ErrTooManyRedirects,
+	ErrParkedDomain,
+	ErrInvalidURL,
+}
+
+// FetchError is returned when a request to a dealer (or a dealer locator)
+// fails. Kind is one of the sentinel errors above and Err is the underlying
+// cause, if any.
+type FetchError struct {
+	Kind       error
+	Dealer     string
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (f *FetchError) Error() string {
+	msg := fmt.Sprintf("could not retrieve %s", f.URL)
+	if f.Dealer != "" {
+		msg = fmt.Sprintf("could not retrieve %s (%s)", f.Dealer, f.URL)
+	}
+
+	msg = fmt.Sprintf("%s: %s", msg, f.Kind)
+
+	if f.StatusCode != 0 {
+		msg = fmt.Sprintf("%s: HTTP %d - %s", msg, f.StatusCode, http.StatusText(f.StatusCode))
+	}
+
+	if f.Err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, f.Err)
+	}
+
+	return msg
+}
+
+func (f *FetchError) Unwrap() []error {
+	if f.Err == nil {
+		return []error{f.Kind}
+	}
+
+	return []error{f.Kind, f.Err}
+}
+
+// ErrorKind returns the sentinel error that err wraps or nil if it does not
+// wrap any of them.
+func ErrorKind(err error) error {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	return nil
+}
+
+// newRequestError wraps an error returned by an http.Client.
+func newRequestError(dealer, u string, err error) *FetchError {
+	kind := ErrNetwork
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		kind = ErrDNS
+	}
+
+	return &FetchError{
+		Kind:   kind,
+		Dealer: dealer,
+		URL:    u,
+		Err:    err,
+	}
+}
+
+// newStatusError is used when a request returns something other than HTTP
+// 200. notFound is the kind to use for an HTTP 404.
+func newStatusError(dealer, u string, statusCode int, notFound error) *FetchError {
+	kind := ErrHTTPStatus
+
+	switch statusCode {
+	case http.StatusNotFound:
+		kind = notFound
+	case http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	}
+
+	return &FetchError{
+		Kind:       kind,
+		Dealer:     dealer,
+		URL:        u,
+		StatusCode: statusCode,
+	}
+}
+
+// newURLError is returned when a dealer's hostname or URL can't be turned into
+// the URL of its website.
+func newURLError(dealer, u string, err error) *FetchError {
+	return &FetchError{
+		Kind:   ErrInvalidURL,
+		Dealer: dealer,
+		URL:    u,
+		Err:    err,
+	}
+}
+
+// newSchemaError wraps an error encountered while decoding a response.
+func newSchemaError(dealer, u string, err error) *FetchError {
+	return &FetchError{
+		Kind:   ErrSchemaMismatch,
+		Dealer: dealer,
+		URL:    u,
+		Err:    err,
+	}
+}
@@ -1,28 +1,42 @@
 package dealer
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
-	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/cheesesashimi/subiescraper/pkg/logging"
 	"github.com/cheesesashimi/subiescraper/pkg/utils"
 	aggError "k8s.io/apimachinery/pkg/util/errors"
 )
 
-const (
-	dealersByStatePath string = "https://www.subaru.com/services/dealers/by/state"
-	newCarPath         string = "/apis/widget/INVENTORY_LISTING_DEFAULT_AUTO_NEW:inventory-data-bus1/getInventory"
-	usedCarPath        string = "/apis/widget/INVENTORY_LISTING_DEFAULT_AUTO_USED:inventory-data-bus1/getInventory"
-)
+var logger = logging.Discard()
 
+// SetLogger sets the logger used by this package. Nothing is logged until this
+// is called.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// savedDealer is a Dealer as read by FromDisk. Dealers saved before
+// inventories were normalized into Vehicles have their Dealer.com new and
+// used inventories instead.
+type savedDealer struct {
+	Dealer
+	New  *InventoryResponse `json:"new"`
+	Used *InventoryResponse `json:"used"`
+}
+
+// FromDisk reads dealers saved as JSON by state, e.g. a data-*.json file.
+// Files saved with the older new and used inventories are read too, with
+// their vehicles converted the same way as the Dealer.com provider does.
 func FromDisk(filename string) (map[string][]Dealer, error) {
 	out := map[string][]Dealer{}
 	b, err := ioutil.ReadFile(filename)
@@ -30,66 +44,87 @@ func FromDisk(filename string) (map[string][]Dealer, error) {
 		return out, err
 	}
 
-	err = json.Unmarshal(b, &out)
+	saved := map[string][]savedDealer{}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return out, err
+	}
 
-	return out, err
+	for state, dealers := range saved {
+		out[state] = []Dealer{}
+
+		for _, sd := range dealers {
+			d := sd.Dealer
+			if d.Vehicles == nil && (sd.New != nil || sd.Used != nil) {
+				d.Provider = string(PlatformDealerCom)
+				d.Vehicles = []Vehicle{}
+
+				if sd.New != nil {
+					d.Vehicles = append(d.Vehicles, ddcVehicles(*sd.New, ConditionNew)...)
+				}
+
+				if sd.Used != nil {
+					d.Vehicles = append(d.Vehicles, ddcVehicles(*sd.Used, ConditionUsed)...)
+				}
+			}
+
+			out[state] = append(out[state], d)
+		}
+	}
+
+	return out, nil
 }
 
+// GetDealerResponseFromReader extracts the dealer from its landing page using
+// the DDC.dataLayer, schema.org JSON-LD and meta tags, in that order of
+// preference. The returned DealerResponse always has its SiteURL set, even
+// when an error is returned, unless the hostname itself is invalid.
 func GetDealerResponseFromReader(r io.Reader, hostname string) (DealerResponse, error) {
-	doc, err := goquery.NewDocumentFromReader(r)
+	return GetDealerResponseWithHeaders(r, nil, hostname)
+}
+
+// GetDealerResponseWithHeaders is the same as GetDealerResponseFromReader but
+// also uses the response headers to detect the dealer's website platform.
+func GetDealerResponseWithHeaders(r io.Reader, header http.Header, hostname string) (DealerResponse, error) {
+	siteURL, err := utils.HostnameToURL(hostname)
 	if err != nil {
-		log.Fatal(err)
+		return DealerResponse{}, newURLError("", hostname, err)
 	}
 
-	fields := []string{
-		"address1",
-		"address2",
-		"city",
-		"country",
-		"postalCode",
-		"stateProvince",
-		"dealershipName",
+	dr := DealerResponse{
+		SiteURL: siteURL,
 	}
 
-	extracted := map[string]string{}
-
-	foundText := ""
-
-	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		foundText = s.Text()
-		foundIt := strings.Contains(foundText, "DDC.dataLayer['dealership'] = {")
-		return !foundIt
-	})
-
-	lines := strings.Split(foundText, "\n")
-	for _, line := range lines {
-		for _, field := range fields {
-			prefix := fmt.Sprintf("\"%s\": ", field)
-			if strings.HasPrefix(line, prefix) {
-				line = strings.ReplaceAll(line, prefix, "")
-				line = strings.TrimRight(line, ",")
-				unquoted, err := strconv.Unquote(line)
-				if err != nil {
-					panic(err)
-				}
-				extracted[field] = unquoted
-			}
-		}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return dr, newRequestError("", siteURL, err)
 	}
 
-	dr := DealerResponse{
-		Name:    extracted["dealershipName"],
-		SiteURL: utils.HostnameToURL(hostname),
-		Address: Address{
-			Street:  extracted["address1"],
-			Street2: extracted["address2"],
-			City:    extracted["city"],
-			State:   extracted["stateProvince"],
-			Zipcode: extracted["postalCode"],
-		},
+	platform := DetectPlatform(header, body)
+	dr.Platform = &platform
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return dr, newSchemaError("", siteURL, fmt.Errorf("could not parse HTML: %w", err))
+	}
+
+	dataLayer, dataLayerErr := GetDataLayerFromDocument(doc)
+	if dataLayerErr != nil && !errors.Is(dataLayerErr, ErrNoDataLayer) {
+		return dr, newSchemaError("", siteURL, dataLayerErr)
+	}
+
+	m := &metadataExtractor{dr: &dr}
+	if dataLayer != nil {
+		dr.DataLayer = dataLayer
+		m.fromDataLayer(dataLayer)
 	}
+	m.fromJSONLD(doc)
+	m.fromMetaTags(doc)
 
-	fmt.Println(dr)
+	if len(dr.FieldSources) == 0 {
+		return dr, &FetchError{Kind: ErrNotDealerCom, URL: siteURL, Err: dataLayerErr}
+	}
+
+	logger.Debug("extracted dealer from landing page", "dealer", dr.Name, "host", hostname, "city", dr.Address.City, "state", dr.Address.State, "platform", platform.Platform, "confidence", platform.Confidence, "sources", len(dr.FieldSources))
 
 	return dr, nil
 }
@@ -101,15 +136,19 @@ func GetDealerResponseFromLandingPage(link string) (DealerResponse, error) {
 
 	resp, err := client.Get(link)
 	if err != nil {
-		return out, err
+		return out, newRequestError("", link, err)
 	}
 
 	defer resp.Body.Close()
 
-	return GetDealerResponseFromReader(resp.Body, resp.Request.URL.Host)
+	if resp.StatusCode != http.StatusOK {
+		return out, newStatusError("", link, resp.StatusCode, ErrHTTPStatus)
+	}
+
+	return GetDealerResponseWithHeaders(resp.Body, resp.Header, resp.Request.URL.Host)
 }
 
-func GetDealerAndInventoryFromLink(link string, inventoryQuery url.Values) (Dealer, error) {
+func GetDealerAndInventoryFromLink(link string, inventoryQuery InventoryQuery) (Dealer, error) {
 	dr, err := GetDealerResponseFromLandingPage(link)
 	if err != nil {
 		return Dealer{}, err
@@ -118,114 +157,107 @@ func GetDealerAndInventoryFromLink(link string, inventoryQuery url.Values) (Deal
 	return GetDealerAndInventory(dr, inventoryQuery)
 }
 
-func GetDealerAndInventory(d DealerResponse, inventoryQuery url.Values) (Dealer, error) {
-	out := Dealer{}
-	out.Dealer = d
-
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	var newErr error
-	var newInventory InventoryResponse
-
-	var usedErr error
-	var usedInventory InventoryResponse
-
-	go func() {
-		defer wg.Done()
-		newInventory, newErr = getInventoryFromPath(d, newCarPath, inventoryQuery)
-	}()
-
-	go func() {
-		defer wg.Done()
-		usedInventory, usedErr = getInventoryFromPath(d, usedCarPath, inventoryQuery)
-	}()
-
-	wg.Wait()
-
-	errs := []error{}
-
-	if newErr != nil {
-		errs = append(errs, fmt.Errorf("could not get new inventory: %w", newErr))
-	}
-
-	if usedErr != nil {
-		errs = append(errs, fmt.Errorf("could not get used inventory: %w", usedErr))
-	}
-
-	out.New = newInventory
-	out.Used = usedInventory
-
-	return out, aggError.NewAggregate(errs)
-}
-
-func getInventoryFromPath(d DealerResponse, inventoryPath string, inventoryQuery url.Values) (InventoryResponse, error) {
-	out := InventoryResponse{}
-
-	u, err := url.Parse(d.SiteURL)
-	if err != nil {
-		return out, fmt.Errorf("could not parse url: %w", err)
+// GetDealerAndInventory fetches the dealer's inventory using the provider
+// registered for its website platform.
+func GetDealerAndInventory(d DealerResponse, query InventoryQuery) (Dealer, error) {
+	out := Dealer{
+		Dealer:   d,
+		Vehicles: []Vehicle{},
 	}
 
-	u.Path = inventoryPath
-	u.RawQuery = inventoryQuery.Encode()
-
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", u.String(), nil)
+	provider, err := GetInventoryProvider(d.GetPlatform())
 	if err != nil {
 		return out, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.55 Safari/537.36")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return out, err
-	}
+	out.Provider = provider.Name()
 
-	if resp.StatusCode != http.StatusOK {
-		return out, fmt.Errorf("could not retrieve cars for %s (%s): HTTP %d - %s", d.Name, u.String(), resp.StatusCode, http.StatusText(resp.StatusCode))
-	}
+	vehicles, err := provider.GetInventory(d, query)
+	out.Vehicles = append(out.Vehicles, vehicles...)
 
-	defer resp.Body.Close()
-	respBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return out, err
-	}
+	return out, err
+}
 
-	if err := json.Unmarshal(respBytes, &out); err != nil {
-		return out, err
-	}
+// Stage is the step of scraping a dealer that failed.
+type Stage string
 
-	for i, item := range out.Inventory {
-		out.Inventory[i].Link = getDirectLink(resp.Request.URL, item.Link)
-	}
+const (
+	// StageLocate is looking up the dealers in a state. A failure here
+	// affects every dealer in it.
+	StageLocate Stage = "locate"
+	// StageRedirect is following a dealer's SiteURL to its real website.
+	StageRedirect Stage = "redirect"
+	// StageInventory is getting a dealer's inventory from its website.
+	StageInventory Stage = "inventory"
+)
 
-	for i, item := range out.PageInfo.TrackingData {
-		out.PageInfo.TrackingData[i].Link = getDirectLink(resp.Request.URL, item.Link)
-	}
+// IsDiscovery is true for the stages before a dealer's website is scraped.
+func (s Stage) IsDiscovery() bool {
+	return s == StageLocate || s == StageRedirect
+}
 
-	return out, nil
+// ByStateOptions controls how ByState scrapes each dealer.
+type ByStateOptions struct {
+	Query InventoryQuery
+	// TryOriginalSiteURL queries the dealer's inventory from the SiteURL
+	// given by the locator when following its redirects fails, instead of
+	// skipping the dealer.
+	TryOriginalSiteURL bool
+	// MaxRedirects is how many redirects are followed from a dealer's
+	// SiteURL before skipping it, DefaultMaxRedirects if zero.
+	MaxRedirects int
+	// Transport is used to follow each dealer's SiteURL,
+	// http.DefaultTransport if nil.
+	Transport http.RoundTripper
 }
 
-func ByState(state string) chan DealerStream {
+// ByState finds the dealers in a state with the locator and queries each of
+// their inventories. Dealers which fail at any stage are sent with Err and
+// Stage set rather than dropped.
+func ByState(locator DealerLocator, state string, opts ByStateOptions) chan DealerStream {
 	dealerStream := make(chan DealerStream)
 
 	go func() {
-		for dealerResp := range GetDealersByStateWithRedirects(state) {
-			if dealerResp.Err != nil {
+		for dealerResp := range getDealersByStateWithRedirects(locator, state, opts) {
+			if dealerResp.Err != nil && (dealerResp.Stage == StageLocate || !opts.TryOriginalSiteURL || dealerResp.SiteURL == "") {
+				logger.Warn("could not find dealer website, skipping", "dealer", dealerResp.Name, "url", dealerResp.SiteURL, "state", state, "stage", dealerResp.Stage, "error", dealerResp.Err)
+				dealerStream <- DealerStream{
+					Dealer:   Dealer{Dealer: dealerResp.DealerResponse},
+					DNSNames: dealerResp.DNSNames,
+					Stage:    dealerResp.Stage,
+					Err:      dealerResp.Err,
+				}
 				continue
 			}
 
-			d, err := GetDealerAndInventory(dealerResp.DealerResponse, url.Values{
-				"make":  []string{"Subaru"},
-				"model": []string{"WRX", "BRZ", "Outback"},
-			})
-			dealerStream <- DealerStream{
-				Dealer: d,
-				Err:    err,
+			if dealerResp.Err != nil {
+				logger.Warn("could not resolve dealer website, trying the original URL", "dealer", dealerResp.Name, "url", dealerResp.SiteURL, "state", state, "error", dealerResp.Err)
 			}
+
+			start := time.Now()
+
+			d, err := GetDealerAndInventory(dealerResp.DealerResponse, opts.Query)
+
+			logger.Debug("queried dealer inventory", "dealer", d.Dealer.Name, "url", d.Dealer.SiteURL, "state", state, "provider", d.Provider, "duration", time.Since(start))
+
+			out := DealerStream{
+				Dealer:   d,
+				DNSNames: dealerResp.DNSNames,
+				Err:      err,
+			}
+
+			if err != nil {
+				out.Stage = StageInventory
+
+				// Both the redirect and the original URL failed, so
+				// the redirect is the more useful error to report.
+				if dealerResp.Err != nil {
+					out.Stage = StageRedirect
+					out.Err = aggError.NewAggregate([]error{dealerResp.Err, err})
+				}
+			}
+
+			dealerStream <- out
 		}
 
 		close(dealerStream)
@@ -234,59 +266,46 @@ func ByState(state string) chan DealerStream {
 	return dealerStream
 }
 
+// GetDealersByState returns the Subaru dealers in a state.
 func GetDealersByState(state string) ([]DealerResponse, error) {
-	out := []DealerResponse{}
-
-	u, err := url.Parse(dealersByStatePath)
-	q := u.Query()
-	q.Add("state", state)
-	q.Add("type", "Active")
-	u.RawQuery = q.Encode()
-	if err != nil {
-		return out, fmt.Errorf("could not parse url: %w", err)
-	}
-
-	resp, err := http.Get(u.String())
-	if err != nil {
-		return out, fmt.Errorf("could not retrieve dealers in %s: %w", state, err)
-	}
-
-	defer resp.Body.Close()
-
-	respBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return out, fmt.Errorf("could not read response: %w", err)
-	}
-
-	if err := json.Unmarshal(respBytes, &out); err != nil {
-		return out, fmt.Errorf("could not parse dealer response: %w", err)
-	}
+	return (&SubaruLocator{}).ByState(state)
+}
 
-	return out, nil
+func GetDealersByStateWithRedirects(locator DealerLocator, state string) chan DealerResponseStream {
+	return getDealersByStateWithRedirects(locator, state, ByStateOptions{})
 }
 
-func GetDealersByStateWithRedirects(state string) chan DealerResponseStream {
+func getDealersByStateWithRedirects(locator DealerLocator, state string, opts ByStateOptions) chan DealerResponseStream {
 	dealerRespChan := make(chan DealerResponseStream)
 
 	go func() {
-		dealerResps, err := GetDealersByState(state)
+		dealerResps, err := locator.ByState(state)
 		if err != nil {
 			dealerRespChan <- DealerResponseStream{
-				Err: err,
+				Stage: StageLocate,
+				Err:   err,
 			}
 			close(dealerRespChan)
 			return
 		}
 
 		for _, dealerResp := range dealerResps {
-			siteURL, dnsNames, err := getDealerHostnameRedirect(dealerResp)
+			probe, err := probeDealerSite(dealerResp, opts)
+			dealerResp.Redirects = probe.redirects
+			dealerResp.OffSiteRedirect = probe.offSite
+
+			stage := Stage("")
 			if err == nil {
-				dealerResp.SiteURL = siteURL
+				dealerResp.SiteURL = probe.siteURL
+				dealerResp.Platform = &probe.platform
+			} else {
+				stage = StageRedirect
 			}
 
 			dealerRespChan <- DealerResponseStream{
 				DealerResponse: dealerResp,
-				DNSNames:       dnsNames,
+				DNSNames:       probe.dnsNames,
+				Stage:          stage,
 				Err:            err,
 			}
 		}
@@ -297,39 +316,74 @@ func GetDealersByStateWithRedirects(state string) chan DealerResponseStream {
 	return dealerRespChan
 }
 
-func getDirectLink(respURL *url.URL, link string) string {
-	u := url.URL{
-		Scheme: respURL.Scheme,
-		Host:   respURL.Host,
-		Path:   link,
-	}
-
-	return u.String()
-}
-
 func GetDealerHostnameRedirect(d DealerResponse) (string, []string, error) {
 	return getDealerHostnameRedirect(d)
 }
 
 func getDealerHostnameRedirect(d DealerResponse) (string, []string, error) {
-	client := &http.Client{}
+	probe, err := probeDealerSite(d, ByStateOptions{})
+	return probe.siteURL, probe.dnsNames, err
+}
+
+// maxProbeBodySize is how much of a dealer's landing page is read when
+// detecting its website platform.
+const maxProbeBodySize int64 = 2 << 20
+
+type siteProbe struct {
+	siteURL   string
+	dnsNames  []string
+	platform  PlatformDetection
+	redirects []RedirectHop
+	offSite   bool
+}
+
+// probeDealerSite follows the redirects from a dealer's SiteURL, as limited
+// by opts.MaxRedirects, and fingerprints the page it ends up on.
+func probeDealerSite(d DealerResponse, opts ByStateOptions) (siteProbe, error) {
+	out := siteProbe{
+		dnsNames: []string{},
+	}
 
-	resp, err := client.Get(d.SiteURL)
+	resp, redirects, err := followRedirects(d.Name, d.SiteURL, opts.MaxRedirects, opts.Transport)
+	out.redirects = redirects
 	if err != nil {
-		return "", []string{}, err
+		return out, err
 	}
 
 	defer resp.Body.Close()
 
-	dnsNames := []string{}
-
 	if resp.TLS != nil {
 		for _, cert := range resp.TLS.PeerCertificates {
 			if cert != nil {
-				dnsNames = append(dnsNames, cert.DNSNames...)
+				out.dnsNames = append(out.dnsNames, cert.DNSNames...)
 			}
 		}
 	}
 
-	return resp.Request.URL.String(), dnsNames, err
+	out.siteURL = resp.Request.URL.String()
+	out.offSite = isOffSiteRedirect(d.SiteURL, out.siteURL)
+
+	if out.offSite {
+		logger.Warn("dealer redirects to another domain", "dealer", d.Name, "url", d.SiteURL, "redirects", FormatRedirects(redirects))
+	}
+
+	if isParkedDomain(out.siteURL) {
+		return out, &FetchError{
+			Kind:   ErrParkedDomain,
+			Dealer: d.Name,
+			URL:    d.SiteURL,
+			Err:    fmt.Errorf("redirects to %s", out.siteURL),
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if err != nil {
+		return out, newRequestError(d.Name, out.siteURL, err)
+	}
+
+	out.platform = DetectPlatform(resp.Header, body)
+
+	logger.Debug("probed dealer site", "dealer", d.Name, "url", out.siteURL, "platform", out.platform.Platform, "confidence", out.platform.Confidence)
+
+	return out, nil
 }
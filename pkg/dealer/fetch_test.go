@@ -0,0 +1,63 @@
+package dealer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFromDisk(t *testing.T) {
+	testCases := []struct {
+		name         string
+		data         string
+		wantProvider string
+		wantVehicles []Vehicle
+	}{
+		{
+			name:         "vehicles",
+			data:         `{"PA": [{"dealer": {"name": "Smith Subaru"}, "provider": "dealerinspire", "vehicles": [{"vin": "4S3", "condition": "new", "provider": "dealerinspire"}]}]}`,
+			wantProvider: "dealerinspire",
+			wantVehicles: []Vehicle{{VIN: "4S3", Condition: ConditionNew, Provider: "dealerinspire"}},
+		},
+		{
+			// Saved before inventories were normalized into vehicles.
+			name: "new and used inventories",
+			data: `{"PA": [{"dealer": {"name": "Smith Subaru"},
+				"new": {"pageInfo": {"trackingData": [{"vin": "4S3", "modelYear": 2024, "make": "Subaru", "model": "Outback"}]}},
+				"used": {"pageInfo": {"trackingData": [{"vin": "JF2", "newOrUsed": "Certified", "make": "Subaru", "model": "Forester"}]}}}]}`,
+			wantProvider: string(PlatformDealerCom),
+			wantVehicles: []Vehicle{
+				{VIN: "4S3", Condition: ConditionNew, Year: 2024, Make: "Subaru", Model: "Outback", Provider: string(PlatformDealerCom), Confidence: ConfidenceAPI},
+				{VIN: "JF2", Condition: normalizeCondition("Certified"), Make: "Subaru", Model: "Forester", Provider: string(PlatformDealerCom), Confidence: ConfidenceAPI},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data-2024-01-01.json")
+			if err := os.WriteFile(path, []byte(testCase.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			byState, err := FromDisk(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dealers := byState["PA"]
+			if len(dealers) != 1 || dealers[0].Dealer.Name != "Smith Subaru" {
+				t.Fatalf("expected Smith Subaru in PA, got %+v", byState)
+			}
+
+			if dealers[0].Provider != testCase.wantProvider {
+				t.Errorf("expected provider %q, got %q", testCase.wantProvider, dealers[0].Provider)
+			}
+
+			if !reflect.DeepEqual(dealers[0].Vehicles, testCase.wantVehicles) {
+				t.Errorf("expected vehicles %+v, got %+v", testCase.wantVehicles, dealers[0].Vehicles)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package dealer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// FileLocator looks dealers up in a JSON file instead of a manufacturer's
+// dealer search. The file is either a list of dealers, e.g. a saved
+// subaru.com response, or dealers keyed by make like the
+// classified-dealers.json written by dealercerts, in which case only the
+// dealers for Make are used.
+type FileLocator struct {
+	Make string
+	Path string
+
+	once    sync.Once
+	dealers []DealerResponse
+	err     error
+}
+
+func (f *FileLocator) Name() string {
+	return "file:" + f.Path
+}
+
+func (f *FileLocator) load() ([]DealerResponse, error) {
+	f.once.Do(func() {
+		f.dealers, f.err = readDealersFile(f.Path, f.Make)
+	})
+
+	return f.dealers, f.err
+}
+
+func readDealersFile(path, make string) ([]DealerResponse, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []DealerResponse{}
+	if err := json.Unmarshal(b, &out); err == nil {
+		return out, nil
+	}
+
+	byMake := map[string][]DealerResponse{}
+	if err := json.Unmarshal(b, &byMake); err != nil {
+		return nil, fmt.Errorf("could not parse dealers file %s: %w", path, newSchemaError("", path, err))
+	}
+
+	for key, dealers := range byMake {
+		if make == "" || strings.EqualFold(key, make) {
+			out = append(out, dealers...)
+		}
+	}
+
+	return out, nil
+}
+
+// Dealers returns every dealer in the file.
+func (f *FileLocator) Dealers() ([]DealerResponse, error) {
+	return f.load()
+}
+
+func (f *FileLocator) ByState(state string) ([]DealerResponse, error) {
+	dealers, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterByState(dealers, state), nil
+}
+
+// ByZip uses the location of a dealer in the ZIP code as the center of the
+// search since the file has no geocoding of its own.
+func (f *FileLocator) ByZip(zip string, radius int) ([]DealerResponse, error) {
+	dealers, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterByZip(dealers, zip, radius, func(a, b string) bool {
+		return a == b
+	}), nil
+}
+
+func (f *FileLocator) ByID(id string) (DealerResponse, error) {
+	dealers, err := f.load()
+	if err != nil {
+		return DealerResponse{}, err
+	}
+
+	return findByID(dealers, id, f.Path)
+}
@@ -0,0 +1,335 @@
+package dealer
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+// FranchiseSource is a kind of evidence that a dealer holds a franchise.
+type FranchiseSource string
+
+const (
+	// FranchiseFromLocator means the make's own dealer locator lists the
+	// dealer.
+	FranchiseFromLocator FranchiseSource = "locator"
+	// FranchiseFromDataLayer means the make is one of the franchises in
+	// the DDC.dataLayer of the dealer's website.
+	FranchiseFromDataLayer FranchiseSource = "dataLayer"
+	// FranchiseFromJSONLD means the make is a schema.org brand of the
+	// dealer's website.
+	FranchiseFromJSONLD FranchiseSource = "jsonld"
+	// FranchiseFromCertificate means the make is in the organization on
+	// the TLS certificate of the dealer's website.
+	FranchiseFromCertificate FranchiseSource = "certificate"
+	// FranchiseFromHostname means the make is in the dealer's hostname.
+	// It is only used when there is no other evidence.
+	FranchiseFromHostname FranchiseSource = "hostname"
+)
+
+// franchiseSourceConfidence is how much each kind of evidence is trusted on
+// its own. Evidence from several sources adds up, see combineConfidence.
+var franchiseSourceConfidence = map[FranchiseSource]float64{
+	FranchiseFromLocator:     0.95,
+	FranchiseFromDataLayer:   0.9,
+	FranchiseFromJSONLD:      0.8,
+	FranchiseFromCertificate: 0.6,
+	FranchiseFromHostname:    0.3,
+}
+
+// Franchise is a make a dealer sells, how confident we are that it does
+// (between 0 and 1) and what that is based on.
+type Franchise struct {
+	Make       string            `json:"make"`
+	Confidence float64           `json:"confidence"`
+	Sources    []FranchiseSource `json:"sources"`
+}
+
+// franchiseMake is a make and the other names it goes by.
+type franchiseMake struct {
+	Make    string
+	Aliases []string
+}
+
+// franchiseMakes are the makes sold by franchised dealers in North America.
+var franchiseMakes = []franchiseMake{
+	{Make: "Acura"},
+	{Make: "Alfa Romeo"},
+	{Make: "Audi"},
+	{Make: "BMW"},
+	{Make: "Buick"},
+	{Make: "Cadillac"},
+	{Make: "Chevrolet", Aliases: []string{"Chevy"}},
+	{Make: "Chrysler"},
+	{Make: "Dodge"},
+	{Make: "Fiat"},
+	{Make: "Ford"},
+	{Make: "Genesis"},
+	{Make: "GMC"},
+	{Make: "Honda"},
+	{Make: "Hyundai"},
+	{Make: "Infiniti"},
+	{Make: "Jaguar"},
+	{Make: "Jeep"},
+	{Make: "Kia"},
+	{Make: "Land Rover"},
+	{Make: "Lexus"},
+	{Make: "Lincoln"},
+	{Make: "Mazda"},
+	{Make: "Mercedes-Benz", Aliases: []string{"Mercedes", "Mercedes Benz"}},
+	{Make: "MINI"},
+	{Make: "Mitsubishi"},
+	{Make: "Nissan"},
+	{Make: "Porsche"},
+	{Make: "Ram"},
+	{Make: "Subaru"},
+	{Make: "Toyota"},
+	{Make: "Volkswagen", Aliases: []string{"VW"}},
+	{Make: "Volvo"},
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// MakeKey is the lowercase key a make is filed under, e.g. land-rover.
+func MakeKey(make string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(make), "-"), "-")
+}
+
+// MakeKeywords are the strings which identify a make in a hostname, e.g.
+// volkswagen and vw. Makes which aren't known only have their key.
+func MakeKeywords(make string) []string {
+	key := MakeKey(make)
+
+	for _, fm := range franchiseMakes {
+		if MakeKey(fm.Make) != key {
+			continue
+		}
+
+		out := []string{}
+		for _, name := range append([]string{fm.Make}, fm.Aliases...) {
+			out = append(out, strings.ReplaceAll(MakeKey(name), "-", ""))
+		}
+
+		return out
+	}
+
+	return []string{strings.ReplaceAll(key, "-", "")}
+}
+
+// MakesIn returns the makes named in free text such as a brand or an
+// organization, e.g. "Subaru of America, Inc." or "Smith Chevrolet Buick
+// GMC". Names have to appear as whole words so that "Mini" doesn't match
+// "minivan".
+func MakesIn(text string) []string {
+	words := " " + nonAlphanumeric.ReplaceAllString(strings.ToLower(text), " ") + " "
+
+	out := []string{}
+	for _, fm := range franchiseMakes {
+		for _, name := range append([]string{fm.Make}, fm.Aliases...) {
+			name = strings.TrimSpace(nonAlphanumeric.ReplaceAllString(strings.ToLower(name), " "))
+			if strings.Contains(words, " "+name+" ") {
+				out = append(out, fm.Make)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// hostnameMakes returns the makes whose keywords are in the hostname and
+// where the first one starts, since dealers are usually named after their
+// main make, e.g. hondaofsubaruville.com.
+func hostnameMakes(hostname string) map[string]int {
+	out := map[string]int{}
+
+	domain, err := utils.RegistrableDomain(hostname)
+	if err != nil {
+		return out
+	}
+
+	// Only the registered name matters, not the public suffix.
+	name := domain
+	if i := strings.IndexByte(domain, '.'); i != -1 {
+		name = domain[:i]
+	}
+
+	for _, fm := range franchiseMakes {
+		for _, keyword := range MakeKeywords(fm.Make) {
+			i := hostnameKeywordIndex(name, keyword)
+			if i == -1 {
+				continue
+			}
+
+			if prev, ok := out[fm.Make]; !ok || i < prev {
+				out[fm.Make] = i
+			}
+		}
+	}
+
+	return out
+}
+
+// hostnameKeywordIndex returns where keyword is in name, or -1 if it isn't.
+// Short keywords such as vw, ram and ford are too likely to be part of another
+// word, e.g. framingham, so they only count at the start or end of the name or
+// next to a hyphen, e.g. vwofsmith, smithvw and smith-vw-cars.
+func hostnameKeywordIndex(name, keyword string) int {
+	if len(keyword) > 4 {
+		return strings.Index(name, keyword)
+	}
+
+	for i := 0; i+len(keyword) <= len(name); i++ {
+		if name[i:i+len(keyword)] != keyword {
+			continue
+		}
+
+		end := i + len(keyword)
+		if i == 0 || end == len(name) || name[i-1] == '-' || name[end] == '-' {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ClassifyFranchises works out which makes a dealer sells from the evidence
+// gathered about it: the makes whose dealer locators list it, the franchises
+// in its dataLayer or schema.org brands, and the organization on its
+// certificate. Only when there is no such evidence is its hostname used, and
+// then every make but the one it starts with gets half the confidence. The
+// franchises are sorted from most to least confident.
+func ClassifyFranchises(d DealerResponse) []Franchise {
+	evidence := map[string]map[FranchiseSource]float64{}
+
+	add := func(make string, source FranchiseSource, confidence float64) {
+		if evidence[make] == nil {
+			evidence[make] = map[FranchiseSource]float64{}
+		}
+
+		if confidence > evidence[make][source] {
+			evidence[make][source] = confidence
+		}
+	}
+
+	for _, locatorMake := range d.LocatorMakes {
+		for _, make := range MakesIn(locatorMake) {
+			add(make, FranchiseFromLocator, franchiseSourceConfidence[FranchiseFromLocator])
+		}
+	}
+
+	brandSource := FranchiseFromJSONLD
+	if d.FieldSources["brands"] == SourceDataLayer {
+		brandSource = FranchiseFromDataLayer
+	}
+
+	for _, brand := range d.Brands {
+		for _, make := range MakesIn(brand) {
+			add(make, brandSource, franchiseSourceConfidence[brandSource])
+		}
+	}
+
+	for _, org := range d.CertificateOrganizations {
+		for _, make := range MakesIn(org) {
+			add(make, FranchiseFromCertificate, franchiseSourceConfidence[FranchiseFromCertificate])
+		}
+	}
+
+	if len(evidence) == 0 {
+		positions := hostnameMakes(d.SiteURL)
+
+		first := -1
+		for _, i := range positions {
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+
+		for make, i := range positions {
+			confidence := franchiseSourceConfidence[FranchiseFromHostname]
+			if i != first {
+				confidence /= 2
+			}
+
+			add(make, FranchiseFromHostname, confidence)
+		}
+	}
+
+	out := []Franchise{}
+	for make, sources := range evidence {
+		f := Franchise{
+			Make:    make,
+			Sources: []FranchiseSource{},
+		}
+
+		confidences := []float64{}
+		for source, confidence := range sources {
+			f.Sources = append(f.Sources, source)
+			confidences = append(confidences, confidence)
+		}
+
+		f.Confidence = combineConfidence(confidences)
+
+		sort.Slice(f.Sources, func(i, j int) bool {
+			return franchiseSourceConfidence[f.Sources[i]] > franchiseSourceConfidence[f.Sources[j]]
+		})
+
+		out = append(out, f)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Confidence != out[j].Confidence {
+			return out[i].Confidence > out[j].Confidence
+		}
+
+		return out[i].Make < out[j].Make
+	})
+
+	return out
+}
+
+// combineConfidence treats each piece of evidence as independent, so the
+// combined confidence is the chance that not all of them are wrong.
+func combineConfidence(confidences []float64) float64 {
+	wrong := 1.0
+	for _, c := range confidences {
+		wrong *= 1 - c
+	}
+
+	return math.Round((1-wrong)*100) / 100
+}
+
+// MarkLocatorDealers records make in the LocatorMakes of every dealer whose
+// website is on the same domain as one listed by make's dealer locator. It
+// returns how many dealers were marked.
+func MarkLocatorDealers(dealers []DealerResponse, make string, locatorDealers []DealerResponse) int {
+	domains := map[string]struct{}{}
+	for _, ld := range locatorDealers {
+		if domain, err := utils.RegistrableDomain(ld.SiteURL); err == nil {
+			domains[domain] = struct{}{}
+		}
+	}
+
+	marked := 0
+	for i := range dealers {
+		domain, err := utils.RegistrableDomain(dealers[i].SiteURL)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := domains[domain]; !ok {
+			continue
+		}
+
+		if !containsString(dealers[i].LocatorMakes, make) {
+			dealers[i].LocatorMakes = append(dealers[i].LocatorMakes, make)
+		}
+
+		marked++
+	}
+
+	return marked
+}
@@ -0,0 +1,125 @@
+package dealer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyFranchises(t *testing.T) {
+	testCases := []struct {
+		name   string
+		dealer DealerResponse
+		want   []Franchise
+	}{
+		{
+			name: "evidence adds up",
+			dealer: DealerResponse{
+				SiteURL:                  "https://www.smithsubaru.com",
+				LocatorMakes:             []string{"Subaru"},
+				Brands:                   []string{"Subaru", "Chevrolet"},
+				FieldSources:             map[string]string{"brands": SourceDataLayer},
+				CertificateOrganizations: []string{"Smith Subaru LLC"},
+			},
+			want: []Franchise{
+				{Make: "Subaru", Confidence: 1, Sources: []FranchiseSource{FranchiseFromLocator, FranchiseFromDataLayer, FranchiseFromCertificate}},
+				{Make: "Chevrolet", Confidence: 0.9, Sources: []FranchiseSource{FranchiseFromDataLayer}},
+			},
+		},
+		{
+			name: "JSON-LD brands",
+			dealer: DealerResponse{
+				SiteURL:      "https://www.smithsubaru.com",
+				Brands:       []string{"Mercedes Benz"},
+				FieldSources: map[string]string{"brands": SourceJSONLD},
+			},
+			want: []Franchise{
+				{Make: "Mercedes-Benz", Confidence: 0.8, Sources: []FranchiseSource{FranchiseFromJSONLD}},
+			},
+		},
+		{
+			name: "hostname is ignored when there is other evidence",
+			dealer: DealerResponse{
+				SiteURL:                  "https://www.smithsubaru.com",
+				CertificateOrganizations: []string{"Smith Toyota"},
+			},
+			want: []Franchise{
+				{Make: "Toyota", Confidence: 0.6, Sources: []FranchiseSource{FranchiseFromCertificate}},
+			},
+		},
+		{
+			name:   "multi-make hostname",
+			dealer: DealerResponse{SiteURL: "https://www.hondaofsubaruville.com"},
+			want: []Franchise{
+				{Make: "Honda", Confidence: 0.3, Sources: []FranchiseSource{FranchiseFromHostname}},
+				{Make: "Subaru", Confidence: 0.15, Sources: []FranchiseSource{FranchiseFromHostname}},
+			},
+		},
+		{
+			name:   "short keyword at the end",
+			dealer: DealerResponse{SiteURL: "https://www.smithvw.com"},
+			want: []Franchise{
+				{Make: "Volkswagen", Confidence: 0.3, Sources: []FranchiseSource{FranchiseFromHostname}},
+			},
+		},
+		{
+			name:   "short keyword at the end before a multi-part suffix",
+			dealer: DealerResponse{SiteURL: "https://www.smithkia.com.mx"},
+			want: []Franchise{
+				{Make: "Kia", Confidence: 0.3, Sources: []FranchiseSource{FranchiseFromHostname}},
+			},
+		},
+		{
+			name:   "short keyword at the start",
+			dealer: DealerResponse{SiteURL: "https://www.fordofsmithville.com"},
+			want: []Franchise{
+				{Make: "Ford", Confidence: 0.3, Sources: []FranchiseSource{FranchiseFromHostname}},
+			},
+		},
+		{
+			name:   "short keyword next to a hyphen",
+			dealer: DealerResponse{SiteURL: "https://www.smith-jeep-cars.com"},
+			want: []Franchise{
+				{Make: "Jeep", Confidence: 0.3, Sources: []FranchiseSource{FranchiseFromHostname}},
+			},
+		},
+		{
+			name:   "short keyword inside a word",
+			dealer: DealerResponse{SiteURL: "https://www.framinghamsubaru.com"},
+			want: []Franchise{
+				{Make: "Subaru", Confidence: 0.3, Sources: []FranchiseSource{FranchiseFromHostname}},
+			},
+		},
+		{
+			name:   "no makes",
+			dealer: DealerResponse{SiteURL: "https://www.smithmotors.com"},
+			want:   []Franchise{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := ClassifyFranchises(testCase.dealer); !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("expected %+v, got %+v", testCase.want, got)
+			}
+		})
+	}
+}
+
+func TestCombineConfidence(t *testing.T) {
+	testCases := []struct {
+		confidences []float64
+		want        float64
+	}{
+		{confidences: nil, want: 0},
+		{confidences: []float64{0.3}, want: 0.3},
+		{confidences: []float64{0.6, 0.3}, want: 0.72},
+		{confidences: []float64{0.8, 0.6, 0.3}, want: 0.94},
+		{confidences: []float64{0.95, 0.9}, want: 1},
+	}
+
+	for _, testCase := range testCases {
+		if got := combineConfidence(testCase.confidences); got != testCase.want {
+			t.Errorf("combineConfidence(%v): expected %v, got %v", testCase.confidences, testCase.want, got)
+		}
+	}
+}
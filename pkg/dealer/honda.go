@@ -0,0 +1,155 @@
+package dealer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const hondaLocatorBaseURL string = "https://automobiles.honda.com/platform/api/v1/dealer"
+
+// hondaMaxResults is how many dealers are asked for in a single search.
+const hondaMaxResults int = 100
+
+// HondaLocator looks dealers up with the automobiles.honda.com dealer search.
+type HondaLocator struct {
+	// Client is used for every request, http.DefaultClient if nil.
+	Client *http.Client
+	// BaseURL overrides
+	// https://automobiles.honda.com/platform/api/v1/dealer. It is used to
+	// replay recorded responses.
+	BaseURL string
+}
+
+func (h *HondaLocator) Name() string {
+	return "automobiles.honda.com"
+}
+
+func (h *HondaLocator) client() *http.Client {
+	if h.Client != nil {
+		return h.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (h *HondaLocator) endpoint(params url.Values) string {
+	baseURL := h.BaseURL
+	if baseURL == "" {
+		baseURL = hondaLocatorBaseURL
+	}
+
+	// A is the automobile division, as opposed to powersports or marine.
+	params.Set("productDivisionCode", "A")
+	params.Set("maxResults", strconv.Itoa(hondaMaxResults))
+
+	return fmt.Sprintf("%s?%s", strings.TrimRight(baseURL, "/"), params.Encode())
+}
+
+type hondaDealerSearch struct {
+	Dealers []hondaDealer `json:"Dealers"`
+}
+
+type hondaDealer struct {
+	DealerNumber string  `json:"DealerNumber"`
+	Name         string  `json:"Name"`
+	Address      string  `json:"Address"`
+	City         string  `json:"City"`
+	State        string  `json:"State"`
+	ZipCode      string  `json:"ZipCode"`
+	Phone        string  `json:"Phone"`
+	WebAddress   string  `json:"WebAddress"`
+	Latitude     float64 `json:"Latitude"`
+	Longitude    float64 `json:"Longitude"`
+	Distance     float64 `json:"Distance"`
+}
+
+func (hd hondaDealer) dealerResponse() DealerResponse {
+	d := DealerResponse{
+		ID:          hd.DealerNumber,
+		Name:        strings.TrimSpace(hd.Name),
+		PhoneNumber: hd.Phone,
+		SiteURL:     strings.TrimSpace(hd.WebAddress),
+		Address: Address{
+			Street:  hd.Address,
+			City:    hd.City,
+			State:   strings.ToUpper(hd.State),
+			Zipcode: hd.ZipCode,
+			Country: CountryUS,
+		},
+		Location: Location{
+			Latitude:  hd.Latitude,
+			Longitude: hd.Longitude,
+		},
+	}
+
+	if d.SiteURL != "" && !strings.Contains(d.SiteURL, "://") {
+		d.SiteURL = "https://" + d.SiteURL
+	}
+
+	return d
+}
+
+func (h *HondaLocator) search(params url.Values) ([]hondaDealer, error) {
+	result := hondaDealerSearch{}
+	if err := getLocatorJSON(h.client(), h.endpoint(params), &result); err != nil {
+		return nil, err
+	}
+
+	return result.Dealers, nil
+}
+
+func (h *HondaLocator) ByState(state string) ([]DealerResponse, error) {
+	dealers, err := h.search(url.Values{"state": []string{state}})
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve dealers in %s: %w", state, err)
+	}
+
+	out := []DealerResponse{}
+	for _, hd := range dealers {
+		out = append(out, hd.dealerResponse())
+	}
+
+	// Dealers near the state line can be included, so only keep the ones
+	// actually in it.
+	return filterByState(out, state), nil
+}
+
+func (h *HondaLocator) ByZip(zip string, radius int) ([]DealerResponse, error) {
+	dealers, err := h.search(url.Values{"zip": []string{zip}})
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve dealers near %s: %w", zip, err)
+	}
+
+	sort.SliceStable(dealers, func(i, j int) bool {
+		return dealers[i].Distance < dealers[j].Distance
+	})
+
+	out := []DealerResponse{}
+	for _, hd := range dealers {
+		if radius > 0 && hd.Distance > float64(radius) {
+			break
+		}
+
+		out = append(out, hd.dealerResponse())
+	}
+
+	return out, nil
+}
+
+func (h *HondaLocator) ByID(id string) (DealerResponse, error) {
+	dealers, err := h.search(url.Values{"dealerNumber": []string{id}})
+	if err != nil {
+		return DealerResponse{}, fmt.Errorf("could not retrieve dealer %s: %w", id, err)
+	}
+
+	out := []DealerResponse{}
+	for _, hd := range dealers {
+		out = append(out, hd.dealerResponse())
+	}
+
+	return findByID(out, id, h.Name())
+}
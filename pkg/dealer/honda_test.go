@@ -0,0 +1,136 @@
+package dealer
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func newHondaFixtureLocator(t *testing.T) (*locatorServer, *HondaLocator) {
+	s, srv := newLocatorServer(t, map[string]func(url.Values) string{
+		"/": func(q url.Values) string {
+			switch {
+			case q.Get("state") == "PA":
+				return "honda/dealers-state-pa.json"
+			case q.Get("zip") == "19103":
+				return "honda/dealers-zip-19103.json"
+			case q.Get("dealerNumber") == "207148":
+				return "honda/dealers-id-207148.json"
+			case q.Has("dealerNumber"):
+				return "honda/dealers-empty.json"
+			}
+			return ""
+		},
+	})
+
+	return s, &HondaLocator{Client: srv.Client(), BaseURL: srv.URL + "/"}
+}
+
+func TestHondaLocatorByState(t *testing.T) {
+	s, l := newHondaFixtureLocator(t)
+
+	dealers, err := l.ByState("PA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Riverside Honda is in NJ, close enough to be included in the results.
+	if got := dealerIDs(dealers); !reflect.DeepEqual(got, []string{"207148", "208312"}) {
+		t.Fatalf("expected only the PA dealers, got %v", got)
+	}
+
+	want := DealerResponse{
+		ID:          "207148",
+		Name:        "Smith Honda",
+		PhoneNumber: "(215) 555-0100",
+		SiteURL:     "https://www.smithhonda.com",
+		Address: Address{
+			Street:  "1200 Market St",
+			City:    "Philadelphia",
+			State:   "PA",
+			Zipcode: "19107",
+			Country: CountryUS,
+		},
+		Location: Location{
+			Latitude:  39.9518,
+			Longitude: -75.1605,
+		},
+	}
+
+	if !reflect.DeepEqual(dealers[0], want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, dealers[0])
+	}
+
+	if got := dealers[1].SiteURL; got != "https://www.keystonehonda.com/" {
+		t.Errorf("expected a site URL with a scheme to be left alone, got %s", got)
+	}
+
+	q := s.queries[0]
+	if q.Get("productDivisionCode") != "A" || q.Get("maxResults") != strconv.Itoa(hondaMaxResults) {
+		t.Errorf("expected automobile dealers to be asked for, got %v", q)
+	}
+}
+
+func TestHondaLocatorByZip(t *testing.T) {
+	testCases := []struct {
+		name   string
+		radius int
+		want   []string
+	}{
+		{
+			name:   "sorted by distance",
+			radius: 0,
+			want:   []string{"207148", "206501", "208312"},
+		},
+		{
+			name:   "within radius",
+			radius: 25,
+			want:   []string{"207148", "206501"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, l := newHondaFixtureLocator(t)
+
+			dealers, err := l.ByZip("19103", testCase.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := dealerIDs(dealers); !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("expected %v, got %v", testCase.want, got)
+			}
+		})
+	}
+}
+
+func TestHondaLocatorByID(t *testing.T) {
+	_, l := newHondaFixtureLocator(t)
+
+	d, err := l.ByID("207148")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Name != "Smith Honda" {
+		t.Errorf("expected Smith Honda, got %+v", d)
+	}
+
+	if _, err := l.ByID("999999"); !errors.Is(err, ErrDealerNotFound) {
+		t.Errorf("expected an unknown dealer not to be found, got %v", err)
+	}
+}
+
+func TestHondaLocatorRegistered(t *testing.T) {
+	l, err := GetDealerLocator("Honda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.ByState("ON"); err == nil {
+		t.Error("expected Canadian provinces not to be covered by the Honda locator")
+	}
+}
@@ -0,0 +1,292 @@
+package dealer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+// DealerLink is another website a dealer's landing page links to, scored by
+// how likely it is to be a dealership, from 0 to 1. Dealer groups usually
+// link to their sister stores, typically in the footer.
+type DealerLink struct {
+	// Hostname is the registrable domain of the link.
+	Hostname string `json:"hostname"`
+	// Text is the text of the first link to it which had any.
+	Text    string   `json:"text,omitempty"`
+	Makes   []string `json:"makes,omitempty"`
+	Score   float64  `json:"score"`
+	Signals []string `json:"signals,omitempty"`
+}
+
+type linkSignal string
+
+const (
+	linkSignalHostnameMake linkSignal = "make in hostname"
+	linkSignalTextMake     linkSignal = "make in link text"
+	linkSignalDealerWord   linkSignal = "dealer word"
+	linkSignalFooter       linkSignal = "footer link"
+	linkSignalPlatform     linkSignal = "dealer platform page"
+)
+
+// linkSignalConfidence is how much each signal is trusted on its own. They
+// add up the same way as franchise evidence, see combineConfidence.
+var linkSignalConfidence = map[linkSignal]float64{
+	linkSignalHostnameMake: 0.4,
+	linkSignalTextMake:     0.3,
+	linkSignalDealerWord:   0.15,
+	linkSignalFooter:       0.2,
+	linkSignalPlatform:     0.2,
+}
+
+// dealerWords are common in dealership names and hostnames.
+var dealerWords = []string{"auto", "autos", "automotive", "cars", "dealership", "motors", "motorcars"}
+
+// nonDealerDomains are linked to from almost every dealer website but are
+// never dealerships themselves.
+var nonDealerDomains = map[string]struct{}{
+	"adobe.com":            {},
+	"apple.com":            {},
+	"autotrader.com":       {},
+	"carfax.com":           {},
+	"cargurus.com":         {},
+	"cars.com":             {},
+	"cdkglobal.com":        {},
+	"dealer.com":           {},
+	"dealerfire.com":       {},
+	"dealerinspire.com":    {},
+	"dealeron.com":         {},
+	"edmunds.com":          {},
+	"facebook.com":         {},
+	"google.com":           {},
+	"googletagmanager.com": {},
+	"instagram.com":        {},
+	"kbb.com":              {},
+	"linkedin.com":         {},
+	"microsoft.com":        {},
+	"mozilla.org":          {},
+	"nhtsa.gov":            {},
+	"pinterest.com":        {},
+	"privacyrights.org":    {},
+	"sincrodigital.com":    {},
+	"tiktok.com":           {},
+	"twitter.com":          {},
+	"wordpress.org":        {},
+	"x.com":                {},
+	"yelp.com":             {},
+	"youtube.com":          {},
+}
+
+// isManufacturerDomain is true for the makes' own websites, e.g. subaru.com
+// and vw.ca, which every dealer links to.
+func isManufacturerDomain(domain string) bool {
+	label := strings.SplitN(domain, ".", 2)[0]
+
+	for _, fm := range franchiseMakes {
+		for _, keyword := range MakeKeywords(fm.Make) {
+			if label == keyword || label == keyword+"usa" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasDealerWord is true if any of the dealer words is in text as a whole word
+// or is a label of domain on its own or after a make, e.g. smith-auto.com or
+// smithsubarucars.com but not automattic.com or oscars.com.
+func hasDealerWord(text, domain string) bool {
+	words := " " + nonAlphanumeric.ReplaceAllString(strings.ToLower(text), " ") + " "
+
+	labels := strings.FieldsFunc(strings.ToLower(domain), func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+
+	for _, word := range dealerWords {
+		if strings.Contains(words, " "+word+" ") {
+			return true
+		}
+
+		for _, label := range labels {
+			if label == word {
+				return true
+			}
+
+			if strings.HasSuffix(label, word) && hasMakeKeyword(strings.TrimSuffix(label, word)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasMakeKeyword is true if any make's keyword is in name, the same way as
+// for hostnameMakes.
+func hasMakeKeyword(name string) bool {
+	for _, fm := range franchiseMakes {
+		for _, keyword := range MakeKeywords(fm.Make) {
+			if hostnameKeywordIndex(name, keyword) != -1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// HasDealerWord is true if the link's hostname or text has one of the words
+// common in dealership names, such as motors or autos.
+func (l DealerLink) HasDealerWord() bool {
+	return containsString(l.Signals, string(linkSignalDealerWord))
+}
+
+// isFooter is true if the selection is inside a footer, either a footer
+// element or one whose id or class says it is one.
+func isFooter(s *goquery.Selection) bool {
+	if s.Closest("footer").Length() != 0 {
+		return true
+	}
+
+	found := false
+	s.ParentsFiltered("[id],[class]").EachWithBreak(func(i int, p *goquery.Selection) bool {
+		id, _ := p.Attr("id")
+		class, _ := p.Attr("class")
+		found = strings.Contains(strings.ToLower(id+" "+class), "footer")
+		return !found
+	})
+
+	return found
+}
+
+// DealerLinks returns the other websites the landing page of the dealer at
+// hostname links to, each once and scored by how likely it is to be a
+// dealership: a make in its hostname or link text, a dealer word such as
+// motors, being linked from the footer and the page itself being on a
+// dealer website platform. Social networks, website platforms and the makes'
+// own websites are left out. The links are sorted from highest to lowest
+// score. header may be nil.
+func DealerLinks(body []byte, header http.Header, hostname string) ([]DealerLink, error) {
+	self, err := utils.RegistrableDomain(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse HTML: %w", err)
+	}
+
+	onPlatform := DetectPlatform(header, body).Confidence >= 0.5
+
+	type candidate struct {
+		link    *DealerLink
+		signals map[linkSignal]struct{}
+	}
+
+	candidates := map[string]*candidate{}
+	order := []string{}
+
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+
+		u, err := url.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return
+		}
+
+		domain, err := utils.RegistrableDomain(u.Host)
+		if err != nil || domain == self {
+			return
+		}
+
+		if _, ok := nonDealerDomains[domain]; ok || isManufacturerDomain(domain) {
+			return
+		}
+
+		c, ok := candidates[domain]
+		if !ok {
+			c = &candidate{
+				link:    &DealerLink{Hostname: domain},
+				signals: map[linkSignal]struct{}{},
+			}
+			candidates[domain] = c
+			order = append(order, domain)
+		}
+
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if text == "" {
+			text, _ = s.Attr("title")
+		}
+
+		if c.link.Text == "" {
+			c.link.Text = text
+		}
+
+		if len(hostnameMakes(domain)) != 0 {
+			c.signals[linkSignalHostnameMake] = struct{}{}
+		}
+
+		for _, make := range MakesIn(text) {
+			c.signals[linkSignalTextMake] = struct{}{}
+			if !containsString(c.link.Makes, make) {
+				c.link.Makes = append(c.link.Makes, make)
+			}
+		}
+
+		if hasDealerWord(text, domain) {
+			c.signals[linkSignalDealerWord] = struct{}{}
+		}
+
+		if isFooter(s) {
+			c.signals[linkSignalFooter] = struct{}{}
+		}
+	})
+
+	out := []DealerLink{}
+	for _, domain := range order {
+		c := candidates[domain]
+
+		for make := range hostnameMakes(domain) {
+			if !containsString(c.link.Makes, make) {
+				c.link.Makes = append(c.link.Makes, make)
+			}
+		}
+
+		sort.Strings(c.link.Makes)
+
+		// Every link on a dealer platform page would get this, so it
+		// only adds to a link which already looks like a dealership.
+		if onPlatform && len(c.signals) != 0 {
+			c.signals[linkSignalPlatform] = struct{}{}
+		}
+
+		confidences := []float64{}
+		for signal := range c.signals {
+			c.link.Signals = append(c.link.Signals, string(signal))
+			confidences = append(confidences, linkSignalConfidence[signal])
+		}
+
+		sort.Strings(c.link.Signals)
+
+		c.link.Score = combineConfidence(confidences)
+		out = append(out, *c.link)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+
+		return out[i].Hostname < out[j].Hostname
+	})
+
+	return out, nil
+}
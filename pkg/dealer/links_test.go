@@ -0,0 +1,71 @@
+package dealer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// platformPage is a dealer.com page linking to a sister store, an unrelated
+// site and a site whose hostname starts with a dealer word.
+const platformPage = `<html><head><script>window.DDC = {}; DDC.dataLayer = {};</script></head><body>
+<a href="https://www.joneshonda.com/">Jones Honda</a>
+<a href="https://www.localnews.com/">Local News</a>
+<a href="https://automattic.com/">Powered by WordPress.com VIP</a>
+<footer><a href="https://www.smithmotors.com/">Smith Motors</a></footer>
+</body></html>`
+
+func TestDealerLinks(t *testing.T) {
+	links, err := DealerLinks([]byte(platformPage), nil, "www.smithsubaru.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signals := map[string][]string{}
+	for _, link := range links {
+		signals[link.Hostname] = link.Signals
+	}
+
+	want := map[string][]string{
+		"joneshonda.com":  {string(linkSignalPlatform), string(linkSignalHostnameMake), string(linkSignalTextMake)},
+		"smithmotors.com": {string(linkSignalPlatform), string(linkSignalDealerWord), string(linkSignalFooter)},
+		// Being on a dealer platform page isn't enough on its own.
+		"localnews.com":  nil,
+		"automattic.com": nil,
+	}
+
+	if !reflect.DeepEqual(signals, want) {
+		t.Errorf("expected signals %v, got %v", want, signals)
+	}
+
+	for _, link := range links {
+		if want[link.Hostname] == nil && link.Score != 0 {
+			t.Errorf("expected %s not to score, got %.2f", link.Hostname, link.Score)
+		}
+	}
+}
+
+func TestHasDealerWord(t *testing.T) {
+	testCases := []struct {
+		text   string
+		domain string
+		want   bool
+	}{
+		{domain: "smith-auto.com", want: true},
+		{domain: "motors.smith.com", want: true},
+		{domain: "smithsubarumotors.com", want: true},
+		{domain: "jonesvwcars.net", want: true},
+		{text: "Jones Automotive Group", domain: "jonesgroup.com", want: true},
+		{text: "Smith Motors", domain: "smithmotors.com", want: true},
+		{domain: "smithmotors.com", want: false},
+		{domain: "oscars.com", want: false},
+		{domain: "automattic.com", want: false},
+		{domain: "carsonrealty.com", want: false},
+		{text: "Autograph collection", domain: "hotels.com", want: false},
+	}
+
+	for _, testCase := range testCases {
+		if got := hasDealerWord(testCase.text, testCase.domain); got != testCase.want {
+			t.Errorf("hasDealerWord(%q, %q): expected %v, got %v", testCase.text, testCase.domain, testCase.want, got)
+		}
+	}
+}
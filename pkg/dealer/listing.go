@@ -0,0 +1,438 @@
+package dealer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	aggError "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ErrNoListingVehicles is returned when none of a dealer's search result pages
+// have any schema.org vehicles on them.
+var ErrNoListingVehicles = errors.New("no schema.org vehicles found on listing pages")
+
+// listingMaxPages is how many pages of search results are followed for each
+// of new and used inventory.
+const listingMaxPages int = 10
+
+// listingPaths are the search result pages tried on a dealer's site, in
+// order. The first one that has any vehicles on it is used.
+var listingPaths = map[string][]string{
+	ConditionNew: {
+		"/new-inventory/index.htm",
+		"/new-vehicles/",
+		"/searchnew.aspx",
+		"/inventory/new",
+		"/new-inventory/",
+	},
+	ConditionUsed: {
+		"/used-inventory/index.htm",
+		"/used-vehicles/",
+		"/searchused.aspx",
+		"/inventory/used",
+		"/used-inventory/",
+	},
+}
+
+// ListingPageProvider scrapes schema.org Vehicle and Car data out of a
+// dealer's search result pages. It works on any platform which publishes
+// that data, but since it depends on how the page is put together the
+// vehicles it finds are marked with ConfidenceScraped.
+type ListingPageProvider struct {
+	// Client is used for every request, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func (p *ListingPageProvider) Name() string {
+	return "listing"
+}
+
+func (p *ListingPageProvider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (p *ListingPageProvider) GetInventory(d DealerResponse, query InventoryQuery) ([]Vehicle, error) {
+	siteURL, err := url.Parse(d.SiteURL)
+	if err != nil {
+		return nil, newURLError(d.Name, d.SiteURL, err)
+	}
+
+	out := []Vehicle{}
+	errs := []error{}
+	conditions := []string{ConditionNew, ConditionUsed}
+
+	for _, condition := range conditions {
+		vehicles, err := p.getListing(d, siteURL, condition)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not get %s inventory: %w", condition, err))
+			continue
+		}
+
+		for _, v := range vehicles {
+			if query.matches(v) {
+				out = append(out, v)
+			}
+		}
+	}
+
+	// A dealer with only used cars, or whose new car page is broken, is
+	// still worth reporting.
+	if len(errs) == len(conditions) {
+		return out, aggError.NewAggregate(errs)
+	}
+
+	for _, err := range errs {
+		logger.Warn("could not get part of dealer inventory", "dealer", d.Name, "url", d.SiteURL, "provider", p.Name(), "error", err)
+	}
+
+	return out, nil
+}
+
+// getListing tries each of the search result paths for the condition until
+// one of them has vehicles on it, then follows its pagination.
+func (p *ListingPageProvider) getListing(d DealerResponse, siteURL *url.URL, condition string) ([]Vehicle, error) {
+	var lastErr error
+
+	for _, path := range listingPaths[condition] {
+		pageURL := siteURL.ResolveReference(&url.URL{Path: path})
+
+		vehicles, err := p.followPages(d, pageURL, condition)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if len(vehicles) != 0 {
+			logger.Debug("scraped listing pages", "dealer", d.Name, "url", pageURL.String(), "condition", condition, "vehicles", len(vehicles))
+			return vehicles, nil
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = newSchemaError(d.Name, siteURL.String(), ErrNoListingVehicles)
+	}
+
+	return nil, lastErr
+}
+
+func (p *ListingPageProvider) followPages(d DealerResponse, pageURL *url.URL, condition string) ([]Vehicle, error) {
+	out := []Vehicle{}
+	seenPages := map[string]struct{}{}
+	seenVehicles := map[string]struct{}{}
+
+	for i := 0; i < listingMaxPages && pageURL != nil; i++ {
+		if _, ok := seenPages[pageURL.String()]; ok {
+			break
+		}
+
+		seenPages[pageURL.String()] = struct{}{}
+
+		body, finalURL, err := fetchPage(p.client(), d.Name, pageURL.String())
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+
+			// Keep what we have if a later page fails.
+			logger.Debug("could not fetch listing page", "dealer", d.Name, "url", pageURL.String(), "error", err)
+			break
+		}
+
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return out, newSchemaError(d.Name, finalURL.String(), err)
+		}
+
+		vehicles := getListingVehicles(doc, finalURL, condition)
+		if len(vehicles) == 0 {
+			break
+		}
+
+		newVehicles := 0
+		for _, v := range vehicles {
+			key := v.VIN
+			if key == "" {
+				key = v.Link
+			}
+
+			if _, ok := seenVehicles[key]; ok && key != "" {
+				continue
+			}
+
+			seenVehicles[key] = struct{}{}
+			out = append(out, v)
+			newVehicles++
+		}
+
+		// Some sites ignore the page parameter and keep returning the
+		// first page.
+		if newVehicles == 0 {
+			break
+		}
+
+		pageURL = getNextPageURL(doc, finalURL)
+	}
+
+	return out, nil
+}
+
+// getListingVehicles extracts the vehicles from a search result page using its
+// JSON-LD, falling back to microdata if there isn't any.
+func getListingVehicles(doc *goquery.Document, pageURL *url.URL, condition string) []Vehicle {
+	out := []Vehicle{}
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &v); err != nil {
+			return
+		}
+
+		for _, node := range findJSONLDVehicles(v) {
+			out = append(out, schemaOrgVehicle(node, pageURL, condition))
+		}
+	})
+
+	if len(out) != 0 {
+		return out
+	}
+
+	doc.Find("[itemscope][itemtype]").Each(func(i int, s *goquery.Selection) {
+		itemType, _ := s.Attr("itemtype")
+		if !isSchemaOrgVehicleType(itemType) {
+			return
+		}
+
+		out = append(out, schemaOrgVehicle(getMicrodata(s), pageURL, condition))
+	})
+
+	return out
+}
+
+// findJSONLDVehicles returns every Vehicle or Car node in a JSON-LD document,
+// including ones nested in an ItemList or @graph.
+func findJSONLDVehicles(v interface{}) []map[string]interface{} {
+	out := []map[string]interface{}{}
+
+	for _, node := range jsonObjects(v) {
+		for _, t := range jsonStrings(node["@type"]) {
+			if isSchemaOrgVehicleType(t) {
+				out = append(out, node)
+				break
+			}
+		}
+
+		for _, nested := range []string{"@graph", "itemListElement", "item"} {
+			if child, ok := node[nested]; ok {
+				out = append(out, findJSONLDVehicles(child)...)
+			}
+		}
+	}
+
+	return out
+}
+
+func isSchemaOrgVehicleType(t string) bool {
+	t = t[strings.LastIndex(t, "/")+1:]
+	return t == "Vehicle" || t == "Car" || t == "MotorizedBicycle" || t == "Motorcycle"
+}
+
+// getMicrodata converts an itemscope element into the same shape as a JSON-LD
+// node so both can be mapped by schemaOrgVehicle.
+func getMicrodata(s *goquery.Selection) map[string]interface{} {
+	out := map[string]interface{}{}
+
+	if itemType, ok := s.Attr("itemtype"); ok {
+		out["@type"] = itemType
+	}
+
+	s.Find("[itemprop]").Each(func(i int, prop *goquery.Selection) {
+		// Only take properties which belong to this item and not a nested
+		// one, e.g. the offer's url vs the vehicle's url.
+		if parent := prop.Parent().Closest("[itemscope]"); parent.Length() == 0 || !parent.IsSelection(s) {
+			return
+		}
+
+		name, _ := prop.Attr("itemprop")
+
+		var value interface{}
+		if _, nested := prop.Attr("itemscope"); nested {
+			value = getMicrodata(prop)
+		} else {
+			value = getMicrodataValue(prop)
+		}
+
+		if _, exists := out[name]; !exists {
+			out[name] = value
+		}
+	})
+
+	return out
+}
+
+func getMicrodataValue(s *goquery.Selection) string {
+	for _, attr := range []string{"content", "href", "src", "value"} {
+		if v, ok := s.Attr(attr); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+
+	return strings.TrimSpace(s.Text())
+}
+
+// schemaOrgVehicle maps a schema.org Vehicle or Car to a Vehicle.
+func schemaOrgVehicle(node map[string]interface{}, pageURL *url.URL, condition string) Vehicle {
+	str := func(fields ...string) string {
+		for _, field := range fields {
+			if v := jsonString(node[field]); v != "" {
+				return strings.TrimSpace(v)
+			}
+		}
+
+		return ""
+	}
+
+	year, _ := strconv.Atoi(firstN(str("vehicleModelDate", "modelDate", "productionDate"), 4))
+
+	v := Vehicle{
+		VIN:           str("vehicleIdentificationNumber", "sku", "productID"),
+		Condition:     condition,
+		Year:          year,
+		Make:          str("brand", "manufacturer"),
+		Model:         str("model"),
+		Trim:          str("vehicleConfiguration"),
+		BodyStyle:     str("bodyType"),
+		ExteriorColor: str("color"),
+		InteriorColor: str("vehicleInteriorColor"),
+		Transmission:  str("vehicleTransmission"),
+		Link:          str("url"),
+		Provider:      "listing",
+		Confidence:    ConfidenceScraped,
+	}
+
+	if v.Model == "" {
+		v.Model = str("name")
+	}
+
+	for _, offer := range jsonObjects(node["offers"]) {
+		if v.Price == 0 {
+			v.Price = parsePrice(jsonString(offer["price"]))
+		}
+
+		if v.Link == "" {
+			v.Link = jsonString(offer["url"])
+		}
+
+		if c := jsonString(offer["itemCondition"]); c != "" {
+			v.Condition = schemaOrgCondition(c, condition)
+		}
+	}
+
+	if c := str("itemCondition"); c != "" {
+		v.Condition = schemaOrgCondition(c, condition)
+	}
+
+	if link, err := url.Parse(v.Link); err == nil && v.Link != "" && !link.IsAbs() {
+		v.Link = pageURL.ResolveReference(link).String()
+	}
+
+	return v
+}
+
+func schemaOrgCondition(itemCondition, fallback string) string {
+	switch {
+	case strings.Contains(itemCondition, "NewCondition"):
+		return ConditionNew
+	case strings.Contains(itemCondition, "UsedCondition"), strings.Contains(itemCondition, "RefurbishedCondition"):
+		return ConditionUsed
+	default:
+		return fallback
+	}
+}
+
+// getNextPageURL finds the link to the next page of search results, or nil
+// if this is the last one.
+func getNextPageURL(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	candidates := []string{}
+
+	doc.Find(`link[rel="next"], a[rel="next"], a[aria-label="Next"], a[aria-label="Next Page"], a[title="Next"], a[title="Next Page"]`).Each(func(i int, s *goquery.Selection) {
+		if href, ok := s.Attr("href"); ok {
+			candidates = append(candidates, href)
+		}
+	})
+
+	doc.Find("a").Each(func(i int, s *goquery.Selection) {
+		text := strings.ToLower(strings.TrimSpace(s.Text()))
+		if text == "next" || text == "next page" || text == "next ›" || text == "next »" || text == "›" || text == "»" {
+			if href, ok := s.Attr("href"); ok {
+				candidates = append(candidates, href)
+			}
+		}
+	})
+
+	for _, candidate := range candidates {
+		if candidate == "" || strings.HasPrefix(candidate, "#") || strings.HasPrefix(strings.ToLower(candidate), "javascript:") {
+			continue
+		}
+
+		next, err := url.Parse(candidate)
+		if err != nil {
+			continue
+		}
+
+		next = pageURL.ResolveReference(next)
+		if next.Host != pageURL.Host || next.String() == pageURL.String() {
+			continue
+		}
+
+		return next
+	}
+
+	return nil
+}
+
+// matches reports whether a vehicle found without server-side filtering
+// satisfies the query.
+func (q InventoryQuery) matches(v Vehicle) bool {
+	if q.Make != "" && v.Make != "" && !strings.EqualFold(q.Make, v.Make) {
+		return false
+	}
+
+	if len(q.Models) != 0 {
+		found := false
+		for _, model := range q.Models {
+			if strings.EqualFold(model, v.Model) || strings.Contains(strings.ToLower(v.Model), strings.ToLower(model)) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if q.Transmission != "" && v.Transmission != "" && !strings.Contains(strings.ToLower(v.Transmission), strings.ToLower(q.Transmission)) {
+		return false
+	}
+
+	return true
+}
+
+func firstN(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,48 @@
+package dealer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const usedListingPage = `<html><head>
+<script type="application/ld+json">
+{"@context":"https://schema.org","@type":"ItemList","itemListElement":[
+ {"@type":"ListItem","position":1,"item":{"@type":"Car","vehicleIdentificationNumber":"JF1VA1A60G9800001","name":"2016 Subaru WRX","brand":{"@type":"Brand","name":"Subaru"},"model":"WRX","vehicleModelDate":"2016","url":"/used/2016-subaru-wrx","offers":{"@type":"Offer","price":"21995"}}}
+]}
+</script></head><body></body></html>`
+
+func TestListingPageProviderPartialInventory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/used-inventory/index.htm" {
+			w.Write([]byte(usedListingPage))
+			return
+		}
+
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	p := &ListingPageProvider{Client: srv.Client()}
+
+	vehicles, err := p.GetInventory(DealerResponse{Name: "Smith Subaru", SiteURL: srv.URL}, InventoryQuery{})
+	if err != nil {
+		t.Fatalf("expected the used inventory without an error, got %v", err)
+	}
+
+	if len(vehicles) != 1 || vehicles[0].VIN != "JF1VA1A60G9800001" || vehicles[0].Condition != ConditionUsed {
+		t.Fatalf("expected the used WRX, got %+v", vehicles)
+	}
+}
+
+func TestListingPageProviderNoInventory(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	p := &ListingPageProvider{Client: srv.Client()}
+
+	if _, err := p.GetInventory(DealerResponse{SiteURL: srv.URL}, InventoryQuery{}); err == nil {
+		t.Fatal("expected an error when no condition could be fetched")
+	}
+}
@@ -0,0 +1,293 @@
+package dealer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	aggError "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ErrDealerNotFound is returned when a dealer ID isn't known to a locator.
+var ErrDealerNotFound = errors.New("dealer not found")
+
+// DealerLocator finds the dealers for a make, usually from the
+// manufacturer's own dealer search.
+type DealerLocator interface {
+	// Name identifies the locator in logs.
+	Name() string
+	// ByState returns the active dealers in a state or province.
+	ByState(state string) ([]DealerResponse, error)
+	// ByZip returns the active dealers within radius miles of a ZIP code,
+	// nearest first.
+	ByZip(zip string, radius int) ([]DealerResponse, error)
+	// ByID returns a single dealer by the locator's ID for it.
+	ByID(id string) (DealerResponse, error)
+}
+
+func init() {
+	RegisterDealerLocator("Subaru", &CountryLocator{
+		Locators: map[string]DealerLocator{
+			CountryUS: &SubaruLocator{},
+		},
+	})
+	RegisterDealerLocator("Honda", &CountryLocator{
+		Locators: map[string]DealerLocator{
+			CountryUS: &HondaLocator{},
+		},
+	})
+}
+
+var (
+	locatorsMu sync.RWMutex
+	locators   = map[string]DealerLocator{}
+)
+
+// RegisterDealerLocator sets the locator used for the given make, replacing
+// any existing one. Makes are case-insensitive.
+func RegisterDealerLocator(make string, l DealerLocator) {
+	locatorsMu.Lock()
+	defer locatorsMu.Unlock()
+
+	locators[strings.ToLower(make)] = l
+}
+
+// GetDealerLocator returns the locator registered for the given make.
+func GetDealerLocator(make string) (DealerLocator, error) {
+	locatorsMu.RLock()
+	defer locatorsMu.RUnlock()
+
+	if l, ok := locators[strings.ToLower(make)]; ok {
+		return l, nil
+	}
+
+	return nil, fmt.Errorf("no dealer locator for make %s", make)
+}
+
+// GetDealerLocatorMakes returns the makes which have a locator registered.
+func GetDealerLocatorMakes() []string {
+	locatorsMu.RLock()
+	defer locatorsMu.RUnlock()
+
+	out := []string{}
+	for make := range locators {
+		out = append(out, make)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// LocatorCovers reports whether l can find dealers in state. Locators which
+// don't say which states they cover are assumed to cover all of them.
+func LocatorCovers(l DealerLocator, state string) bool {
+	if c, ok := l.(interface{ Covers(string) bool }); ok {
+		return c.Covers(state)
+	}
+
+	return true
+}
+
+// CountryLocator sends each lookup to the locator for the country it is in,
+// for makes whose US and Canadian dealer searches are separate.
+type CountryLocator struct {
+	Locators map[string]DealerLocator
+}
+
+func (c *CountryLocator) Name() string {
+	names := []string{}
+	for _, country := range c.countries() {
+		names = append(names, c.Locators[country].Name())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (c *CountryLocator) countries() []string {
+	out := []string{}
+	for country := range c.Locators {
+		out = append(out, country)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+func (c *CountryLocator) locator(country string) (DealerLocator, error) {
+	if l, ok := c.Locators[country]; ok {
+		return l, nil
+	}
+
+	return nil, fmt.Errorf("no dealer locator for country %s", country)
+}
+
+// Covers reports whether there is a locator for the country state is in.
+func (c *CountryLocator) Covers(state string) bool {
+	r, ok := LookupRegion(state)
+	if !ok {
+		return false
+	}
+
+	_, ok = c.Locators[r.Country]
+	return ok
+}
+
+func (c *CountryLocator) ByState(state string) ([]DealerResponse, error) {
+	r, ok := LookupRegion(state)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRegion, state)
+	}
+
+	l, err := c.locator(r.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.ByState(r.Code)
+}
+
+// ByZip treats anything with a letter in it as a Canadian postal code.
+func (c *CountryLocator) ByZip(zip string, radius int) ([]DealerResponse, error) {
+	country := CountryUS
+	if strings.IndexFunc(zip, unicode.IsLetter) != -1 {
+		country = CountryCA
+	}
+
+	l, err := c.locator(country)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.ByZip(zip, radius)
+}
+
+// ByID tries each country's locator since IDs don't say which one they came
+// from.
+func (c *CountryLocator) ByID(id string) (DealerResponse, error) {
+	errs := []error{}
+
+	for _, country := range c.countries() {
+		d, err := c.Locators[country].ByID(id)
+		if err == nil {
+			return d, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return DealerResponse{}, aggError.NewAggregate(errs)
+}
+
+func filterByState(dealers []DealerResponse, state string) []DealerResponse {
+	out := []DealerResponse{}
+	for _, d := range dealers {
+		if strings.EqualFold(d.Address.State, state) {
+			out = append(out, d)
+		}
+	}
+
+	return out
+}
+
+// filterByZip returns the dealers within radius miles of the first dealer in
+// the same area as zip which has a location. If none of them do, or radius
+// is 0, only the dealers in the same area are returned.
+func filterByZip(dealers []DealerResponse, zip string, radius int, sameArea func(a, b string) bool) []DealerResponse {
+	out := []DealerResponse{}
+
+	var center *Location
+	for _, d := range dealers {
+		if !sameArea(d.Address.Zipcode, zip) {
+			continue
+		}
+
+		out = append(out, d)
+
+		if center == nil && d.Location.known() {
+			loc := d.Location
+			center = &loc
+		}
+	}
+
+	if center == nil || radius <= 0 {
+		return out
+	}
+
+	out = []DealerResponse{}
+	for _, d := range dealers {
+		if d.Location.known() && distanceMiles(*center, d.Location) <= float64(radius) {
+			out = append(out, d)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return distanceMiles(*center, out[i].Location) < distanceMiles(*center, out[j].Location)
+	})
+
+	return out
+}
+
+func findByID(dealers []DealerResponse, id, source string) (DealerResponse, error) {
+	for _, d := range dealers {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+
+	return DealerResponse{}, fmt.Errorf("could not find dealer %s in %s: %w", id, source, ErrDealerNotFound)
+}
+
+// getLocatorJSON fetches a locator endpoint and decodes its response into
+// out.
+func getLocatorJSON(client *http.Client, u string, out interface{}) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return newRequestError("", u, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newStatusError("", u, resp.StatusCode, ErrHTTPStatus)
+	}
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return newRequestError("", u, err)
+	}
+
+	if err := json.Unmarshal(respBytes, out); err != nil {
+		return newSchemaError("", u, err)
+	}
+
+	return nil
+}
+
+// distanceMiles is the great-circle distance between two locations.
+func distanceMiles(a, b Location) float64 {
+	const earthRadiusMiles float64 = 3958.8
+
+	toRad := func(deg float64) float64 {
+		return deg * math.Pi / 180
+	}
+
+	dLat := toRad(b.Latitude - a.Latitude)
+	dLng := toRad(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(a.Latitude))*math.Cos(toRad(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadiusMiles * math.Asin(math.Sqrt(h))
+}
+
+func (l Location) known() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
@@ -0,0 +1,72 @@
+package dealer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// locatorServer serves a fixture for each request path and records the
+// queries it gets.
+type locatorServer struct {
+	t *testing.T
+	// fixtures maps a request path to a function which picks the fixture for
+	// its query, or returns an empty string for a 404.
+	fixtures map[string]func(url.Values) string
+	queries  []url.Values
+}
+
+func newLocatorServer(t *testing.T, fixtures map[string]func(url.Values) string) (*locatorServer, *httptest.Server) {
+	s := &locatorServer{t: t, fixtures: fixtures}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *locatorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.queries = append(s.queries, r.URL.Query())
+
+	fixture, ok := s.fixtures[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := fixture(r.URL.Query())
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(readFixture(s.t, name))
+}
+
+func dealerIDs(dealers []DealerResponse) []string {
+	ids := []string{}
+	for _, d := range dealers {
+		ids = append(ids, d.ID)
+	}
+
+	return ids
+}
+
+func TestLocatorCovers(t *testing.T) {
+	subaru, err := GetDealerLocator("Subaru")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !LocatorCovers(subaru, "PA") {
+		t.Error("expected the Subaru locator to cover PA")
+	}
+
+	if LocatorCovers(subaru, "ON") {
+		t.Error("expected the Subaru locator not to cover ON")
+	}
+
+	if !LocatorCovers(&FileLocator{}, "ON") {
+		t.Error("expected a locator without a Covers method to cover every state")
+	}
+}
@@ -0,0 +1,387 @@
+package dealer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Where a DealerResponse field was extracted from, see
+// DealerResponse.FieldSources.
+const (
+	SourceDataLayer string = "dataLayer"
+	SourceJSONLD    string = "jsonld"
+	SourceMeta      string = "meta"
+)
+
+// The schema.org types that describe a dealership, in order of preference.
+var jsonLDDealerTypes = []string{
+	"AutoDealer",
+	"AutomotiveBusiness",
+	"LocalBusiness",
+}
+
+// metadataExtractor fills in a DealerResponse from several sources. The first
+// source to provide a field wins, so sources should be applied from most to
+// least trustworthy.
+type metadataExtractor struct {
+	dr *DealerResponse
+}
+
+func (m *metadataExtractor) setSource(field, source string) {
+	if m.dr.FieldSources == nil {
+		m.dr.FieldSources = map[string]string{}
+	}
+
+	m.dr.FieldSources[field] = source
+}
+
+func (m *metadataExtractor) setString(field, source, value string, dst *string) {
+	value = strings.TrimSpace(value)
+	if value == "" || *dst != "" {
+		return
+	}
+
+	*dst = value
+	m.setSource(field, source)
+}
+
+func (m *metadataExtractor) setStrings(field, source string, values []string, dst *[]string) {
+	if len(*dst) != 0 {
+		return
+	}
+
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" && !containsString(*dst, value) {
+			*dst = append(*dst, value)
+		}
+	}
+
+	if len(*dst) != 0 {
+		m.setSource(field, source)
+	}
+}
+
+func (m *metadataExtractor) setLocation(source string, lat, lng float64) {
+	if lat == 0 && lng == 0 {
+		return
+	}
+
+	if m.dr.Location.Latitude != 0 || m.dr.Location.Longitude != 0 {
+		return
+	}
+
+	m.dr.Location.Latitude = lat
+	m.dr.Location.Longitude = lng
+	m.setSource("location", source)
+}
+
+func (m *metadataExtractor) fromDataLayer(dataLayer map[string]interface{}) {
+	str := func(fields ...string) string {
+		for _, field := range fields {
+			if v := dataLayerString(dataLayer, field); v != "" {
+				return v
+			}
+		}
+
+		return ""
+	}
+
+	m.setString("id", SourceDataLayer, str("dealershipId", "dealerId", "accountId", "dealerCode"), &m.dr.ID)
+	m.setString("name", SourceDataLayer, str("dealershipName", "name"), &m.dr.Name)
+	m.setString("address.street", SourceDataLayer, str("address1"), &m.dr.Address.Street)
+	m.setString("address.street2", SourceDataLayer, str("address2"), &m.dr.Address.Street2)
+	m.setString("address.city", SourceDataLayer, str("city"), &m.dr.Address.City)
+	m.setString("address.county", SourceDataLayer, str("county"), &m.dr.Address.County)
+	m.setString("address.state", SourceDataLayer, str("stateProvince", "state"), &m.dr.Address.State)
+	m.setString("address.zipcode", SourceDataLayer, str("postalCode", "zip"), &m.dr.Address.Zipcode)
+	m.setString("address.country", SourceDataLayer, str("country"), &m.dr.Address.Country)
+	m.setString("phoneNumber", SourceDataLayer, str("phone", "phoneNumber", "salesPhone"), &m.dr.PhoneNumber)
+	m.setString("servicePhoneNumber", SourceDataLayer, str("servicePhone", "servicePhoneNumber"), &m.dr.ServicePhoneNumber)
+	m.setString("faxNumber", SourceDataLayer, str("fax", "faxNumber"), &m.dr.FaxNumber)
+	m.setStrings("brands", SourceDataLayer, jsonStrings(dataLayer["franchises"]), &m.dr.Brands)
+	m.setStrings("brands", SourceDataLayer, jsonStrings(dataLayer["makes"]), &m.dr.Brands)
+
+	lat, latOK := jsonFloat(dataLayer["latitude"])
+	lng, lngOK := jsonFloat(dataLayer["longitude"])
+	if latOK && lngOK {
+		m.setLocation(SourceDataLayer, lat, lng)
+	}
+}
+
+func (m *metadataExtractor) fromJSONLD(doc *goquery.Document) {
+	dealerNode := findJSONLDDealer(doc)
+	if dealerNode == nil {
+		return
+	}
+
+	str := func(node map[string]interface{}, field string) string {
+		return jsonString(node[field])
+	}
+
+	m.setString("id", SourceJSONLD, str(dealerNode, "@id"), &m.dr.ID)
+	m.setString("name", SourceJSONLD, str(dealerNode, "name"), &m.dr.Name)
+	m.setString("phoneNumber", SourceJSONLD, str(dealerNode, "telephone"), &m.dr.PhoneNumber)
+	m.setString("faxNumber", SourceJSONLD, str(dealerNode, "faxNumber"), &m.dr.FaxNumber)
+
+	if address, ok := dealerNode["address"].(map[string]interface{}); ok {
+		m.setString("address.street", SourceJSONLD, str(address, "streetAddress"), &m.dr.Address.Street)
+		m.setString("address.city", SourceJSONLD, str(address, "addressLocality"), &m.dr.Address.City)
+		m.setString("address.state", SourceJSONLD, str(address, "addressRegion"), &m.dr.Address.State)
+		m.setString("address.zipcode", SourceJSONLD, str(address, "postalCode"), &m.dr.Address.Zipcode)
+		m.setString("address.country", SourceJSONLD, str(address, "addressCountry"), &m.dr.Address.Country)
+	}
+
+	if geo, ok := dealerNode["geo"].(map[string]interface{}); ok {
+		lat, latOK := jsonFloat(geo["latitude"])
+		lng, lngOK := jsonFloat(geo["longitude"])
+		if latOK && lngOK {
+			m.setLocation(SourceJSONLD, lat, lng)
+		}
+	}
+
+	m.setStrings("brands", SourceJSONLD, jsonStrings(dealerNode["brand"]), &m.dr.Brands)
+	m.setStrings("hours.sales", SourceJSONLD, getJSONLDHours(dealerNode), &m.dr.Hours.Sales)
+
+	// The departments say which of sales, service and parts the dealer
+	// has, so there are no types without them.
+	types := []string{}
+
+	for _, department := range jsonObjects(dealerNode["department"]) {
+		switch {
+		case hasJSONLDType(department, "AutoRepair") || strings.Contains(strings.ToLower(str(department, "name")), "service"):
+			types = append(types, "Service")
+			m.setString("servicePhoneNumber", SourceJSONLD, str(department, "telephone"), &m.dr.ServicePhoneNumber)
+			m.setStrings("hours.service", SourceJSONLD, getJSONLDHours(department), &m.dr.Hours.Service)
+		case hasJSONLDType(department, "AutoPartsStore") || strings.Contains(strings.ToLower(str(department, "name")), "parts"):
+			types = append(types, "Parts")
+		case hasJSONLDType(department, "AutoDealer") || strings.Contains(strings.ToLower(str(department, "name")), "sales"):
+			types = append(types, "Sales")
+			m.setString("phoneNumber", SourceJSONLD, str(department, "telephone"), &m.dr.PhoneNumber)
+			m.setStrings("hours.sales", SourceJSONLD, getJSONLDHours(department), &m.dr.Hours.Sales)
+		}
+	}
+
+	m.setStrings("types", SourceJSONLD, types, &m.dr.Types)
+}
+
+func (m *metadataExtractor) fromMetaTags(doc *goquery.Document) {
+	meta := map[string]string{}
+
+	doc.Find("meta").Each(func(i int, s *goquery.Selection) {
+		content, ok := s.Attr("content")
+		if !ok {
+			return
+		}
+
+		for _, attr := range []string{"property", "name", "itemprop"} {
+			if key, ok := s.Attr(attr); ok && key != "" {
+				key = strings.ToLower(key)
+				if _, seen := meta[key]; !seen {
+					meta[key] = content
+				}
+			}
+		}
+	})
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := strings.TrimSpace(meta[key]); v != "" {
+				return v
+			}
+		}
+
+		return ""
+	}
+
+	m.setString("name", SourceMeta, first("og:site_name", "business:contact_data:name"), &m.dr.Name)
+	m.setString("phoneNumber", SourceMeta, first("business:contact_data:phone_number", "og:phone_number", "telephone"), &m.dr.PhoneNumber)
+	m.setString("faxNumber", SourceMeta, first("business:contact_data:fax_number", "og:fax_number"), &m.dr.FaxNumber)
+	m.setString("address.street", SourceMeta, first("business:contact_data:street_address", "og:street-address"), &m.dr.Address.Street)
+	m.setString("address.city", SourceMeta, first("business:contact_data:locality", "og:locality", "geo.placename"), &m.dr.Address.City)
+	m.setString("address.state", SourceMeta, first("business:contact_data:region", "og:region"), &m.dr.Address.State)
+	m.setString("address.zipcode", SourceMeta, first("business:contact_data:postal_code", "og:postal-code"), &m.dr.Address.Zipcode)
+	m.setString("address.country", SourceMeta, first("business:contact_data:country_name", "og:country-name"), &m.dr.Address.Country)
+
+	// geo.region looks like US-PA.
+	if region := first("geo.region"); strings.Contains(region, "-") {
+		parts := strings.SplitN(region, "-", 2)
+		m.setString("address.country", SourceMeta, parts[0], &m.dr.Address.Country)
+		m.setString("address.state", SourceMeta, parts[1], &m.dr.Address.State)
+	}
+
+	// geo.position is lat;lng while ICBM is lat, lng.
+	if position := first("geo.position", "icbm"); position != "" {
+		parts := strings.FieldsFunc(position, func(r rune) bool {
+			return r == ';' || r == ','
+		})
+
+		if len(parts) == 2 {
+			lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lng, lngErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if latErr == nil && lngErr == nil {
+				m.setLocation(SourceMeta, lat, lng)
+			}
+		}
+	}
+
+	lat, latErr := strconv.ParseFloat(first("place:location:latitude"), 64)
+	lng, lngErr := strconv.ParseFloat(first("place:location:longitude"), 64)
+	if latErr == nil && lngErr == nil {
+		m.setLocation(SourceMeta, lat, lng)
+	}
+}
+
+// findJSONLDDealer returns the JSON-LD node which best describes the
+// dealership, or nil if there isn't one. Scripts that aren't valid JSON are
+// ignored.
+func findJSONLDDealer(doc *goquery.Document) map[string]interface{} {
+	nodes := []map[string]interface{}{}
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &v); err != nil {
+			logger.Debug("ignoring invalid JSON-LD", "error", err)
+			return
+		}
+
+		nodes = append(nodes, flattenJSONLD(v)...)
+	})
+
+	for _, wanted := range jsonLDDealerTypes {
+		for _, node := range nodes {
+			if hasJSONLDType(node, wanted) {
+				return node
+			}
+		}
+	}
+
+	return nil
+}
+
+// flattenJSONLD returns every top-level node in a JSON-LD document, including
+// the ones in an @graph.
+func flattenJSONLD(v interface{}) []map[string]interface{} {
+	out := []map[string]interface{}{}
+
+	for _, node := range jsonObjects(v) {
+		out = append(out, node)
+		if graph, ok := node["@graph"]; ok {
+			out = append(out, flattenJSONLD(graph)...)
+		}
+	}
+
+	return out
+}
+
+func hasJSONLDType(node map[string]interface{}, wanted string) bool {
+	for _, t := range jsonStrings(node["@type"]) {
+		if strings.TrimPrefix(strings.TrimPrefix(t, "https://schema.org/"), "http://schema.org/") == wanted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getJSONLDHours returns a node's opening hours as human-readable strings,
+// e.g. "Mo-Fr 09:00-20:00" or "Saturday 09:00-17:00".
+func getJSONLDHours(node map[string]interface{}) []string {
+	hours := jsonStrings(node["openingHours"])
+
+	for _, spec := range jsonObjects(node["openingHoursSpecification"]) {
+		days := []string{}
+		for _, day := range jsonStrings(spec["dayOfWeek"]) {
+			day = strings.TrimPrefix(strings.TrimPrefix(day, "https://schema.org/"), "http://schema.org/")
+			days = append(days, day)
+		}
+
+		opens := jsonString(spec["opens"])
+		closes := jsonString(spec["closes"])
+		if len(days) == 0 || (opens == "" && closes == "") {
+			continue
+		}
+
+		hours = append(hours, fmt.Sprintf("%s %s-%s", strings.Join(days, ","), opens, closes))
+	}
+
+	return hours
+}
+
+// jsonObjects returns v if it is an object or the objects in v if it is an
+// array.
+func jsonObjects(v interface{}) []map[string]interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{t}
+	case []interface{}:
+		out := []map[string]interface{}{}
+		for _, item := range t {
+			if obj, ok := item.(map[string]interface{}); ok {
+				out = append(out, obj)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// jsonString returns v as a string. Objects, such as a schema.org Brand or
+// Country, are represented by their name.
+func jsonString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case map[string]interface{}:
+		return jsonString(t["name"])
+	default:
+		return ""
+	}
+}
+
+// jsonStrings returns v as a list of strings whether it is a single value or
+// an array of them.
+func jsonStrings(v interface{}) []string {
+	out := []string{}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+
+	for _, item := range items {
+		if s := jsonString(item); s != "" {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+func jsonFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if strings.EqualFold(s, needle) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package dealer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestGetDealerResponseFromReader(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fixture     string
+		hostname    string
+		want        DealerResponse
+		wantSources map[string]string
+	}{
+		{
+			// The dataLayer wins over JSON-LD, which wins over the
+			// meta tags, and each fills in what the ones before it
+			// left out. The dataLayer's phone is an expression and
+			// its street is empty, so both come from JSON-LD.
+			name:     "all sources",
+			fixture:  "metadata/all-sources.html",
+			hostname: "smithsubaru.com",
+			want: DealerResponse{
+				ID:   "smithsubaru",
+				Name: "Smith Subaru",
+				Address: Address{
+					Street:  "100 Market St",
+					City:    "Philadelphia",
+					State:   "PA",
+					Zipcode: "19103",
+					Country: "US",
+				},
+				PhoneNumber:        "215-555-0100",
+				ServicePhoneNumber: "215-555-0101",
+				FaxNumber:          "215-555-0199",
+				SiteURL:            "https://www.smithsubaru.com",
+				Types:              []string{"Service", "Parts"},
+				Location:           Location{Latitude: 39.95, Longitude: -75.16},
+				Brands:             []string{"Subaru"},
+			},
+			wantSources: map[string]string{
+				"id":                 SourceDataLayer,
+				"name":               SourceDataLayer,
+				"address.street":     SourceJSONLD,
+				"address.city":       SourceDataLayer,
+				"address.state":      SourceJSONLD,
+				"address.zipcode":    SourceDataLayer,
+				"address.country":    SourceMeta,
+				"phoneNumber":        SourceJSONLD,
+				"servicePhoneNumber": SourceJSONLD,
+				"faxNumber":          SourceMeta,
+				"brands":             SourceDataLayer,
+				"location":           SourceJSONLD,
+				"types":              SourceJSONLD,
+			},
+		},
+		{
+			// A WebSite node doesn't describe the dealer, and without
+			// any departments there are no types.
+			name:     "meta tags only",
+			fixture:  "metadata/meta-only.html",
+			hostname: "jonessubaru.com",
+			want: DealerResponse{
+				Name: "Jones Subaru",
+				Address: Address{
+					Street:  "200 Main St",
+					City:    "Media",
+					State:   "PA",
+					Country: "US",
+				},
+				PhoneNumber: "610-555-0100",
+				SiteURL:     "https://www.jonessubaru.com",
+				Location:    Location{Latitude: 39.91, Longitude: -75.38},
+			},
+			wantSources: map[string]string{
+				"name":            SourceMeta,
+				"address.street":  SourceMeta,
+				"address.city":    SourceMeta,
+				"address.state":   SourceMeta,
+				"address.country": SourceMeta,
+				"phoneNumber":     SourceMeta,
+				"location":        SourceMeta,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dr, err := GetDealerResponseFromReader(bytes.NewReader(readFixture(t, testCase.fixture)), testCase.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dr.FieldSources, testCase.wantSources) {
+				t.Errorf("expected field sources %v, got %v", testCase.wantSources, dr.FieldSources)
+			}
+
+			// Only the extracted fields are compared.
+			dr.FieldSources = nil
+			dr.DataLayer = nil
+			dr.Platform = nil
+
+			if !reflect.DeepEqual(dr, testCase.want) {
+				t.Errorf("expected %+v, got %+v", testCase.want, dr)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package dealer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Platform is the website platform a dealer's site is built on.
+type Platform string
+
+const (
+	PlatformUnknown       Platform = "unknown"
+	PlatformDealerCom     Platform = "dealer.com"
+	PlatformDealerInspire Platform = "dealerinspire"
+	PlatformDealerOn      Platform = "dealeron"
+	PlatformSincro        Platform = "sincro"
+	PlatformDealerFire    Platform = "dealerfire"
+)
+
+// PlatformDetection is the result of fingerprinting a dealer's landing page.
+// Confidence ranges from 0 (no idea) to 1 (certain) and Signals lists the
+// evidence which was found.
+type PlatformDetection struct {
+	Platform   Platform `json:"platform"`
+	Confidence float64  `json:"confidence"`
+	Signals    []string `json:"signals,omitempty"`
+}
+
+func (p *PlatformDetection) String() string {
+	if p == nil || p.Platform == "" || p.Platform == PlatformUnknown {
+		return string(PlatformUnknown)
+	}
+
+	return fmt.Sprintf("%s (%.0f%%)", p.Platform, p.Confidence*100)
+}
+
+type fingerprintKind string
+
+const (
+	fingerprintScriptGlobal fingerprintKind = "script global"
+	fingerprintAssetHost    fingerprintKind = "asset host"
+	fingerprintGenerator    fingerprintKind = "generator"
+	fingerprintHeader       fingerprintKind = "header"
+)
+
+// fingerprint is a piece of evidence that a page belongs to a platform. For
+// headers, value is "Header-Name: substring".
+type fingerprint struct {
+	platform Platform
+	kind     fingerprintKind
+	value    string
+	weight   float64
+}
+
+var fingerprints = []fingerprint{
+	{PlatformDealerCom, fingerprintScriptGlobal, "DDC.dataLayer", 0.6},
+	{PlatformDealerCom, fingerprintScriptGlobal, "window.DDC", 0.3},
+	{PlatformDealerCom, fingerprintAssetHost, "pictures.dealer.com", 0.3},
+	{PlatformDealerCom, fingerprintAssetHost, "static.dealer.com", 0.3},
+	{PlatformDealerCom, fingerprintAssetHost, "/apis/widget/INVENTORY_LISTING", 0.4},
+	{PlatformDealerCom, fingerprintGenerator, "dealer.com", 0.5},
+	{PlatformDealerCom, fingerprintHeader, "X-Ddc-Proxy-Host:", 0.5},
+
+	{PlatformDealerInspire, fingerprintScriptGlobal, "DealerInspire", 0.4},
+	{PlatformDealerInspire, fingerprintScriptGlobal, "inventoryLightningSettings", 0.4},
+	{PlatformDealerInspire, fingerprintAssetHost, "dealerinspire.com", 0.4},
+	{PlatformDealerInspire, fingerprintAssetHost, "/wp-content/plugins/dealerinspire", 0.4},
+	{PlatformDealerInspire, fingerprintGenerator, "dealer inspire", 0.5},
+
+	{PlatformDealerOn, fingerprintScriptGlobal, "DealerOn", 0.4},
+	{PlatformDealerOn, fingerprintScriptGlobal, "DlronGlobal", 0.4},
+	{PlatformDealerOn, fingerprintAssetHost, "dealeron.com", 0.4},
+	{PlatformDealerOn, fingerprintAssetHost, "/searchnew.aspx", 0.3},
+	{PlatformDealerOn, fingerprintGenerator, "dealeron", 0.5},
+
+	{PlatformSincro, fingerprintScriptGlobal, "ContextManager", 0.3},
+	{PlatformSincro, fingerprintAssetHost, "cdkglobal.com", 0.4},
+	{PlatformSincro, fingerprintAssetHost, "cobaltgroup.com", 0.4},
+	{PlatformSincro, fingerprintAssetHost, "sincrodigital.com", 0.4},
+	{PlatformSincro, fingerprintGenerator, "sincro", 0.5},
+	{PlatformSincro, fingerprintHeader, "X-Cdk-Site:", 0.5},
+
+	{PlatformDealerFire, fingerprintScriptGlobal, "DealerFire", 0.4},
+	{PlatformDealerFire, fingerprintAssetHost, "dealerfire.com", 0.4},
+	{PlatformDealerFire, fingerprintGenerator, "dealerfire", 0.5},
+}
+
+// pageTextWeight is how much a script global or asset host counts for when it
+// is only mentioned in the page, e.g. in a "website by" credit or a link,
+// rather than in its scripts or the assets it loads.
+const pageTextWeight = 0.25
+
+// landingPage is the parts of a landing page the fingerprints are checked
+// against, all lowercase.
+type landingPage struct {
+	// scripts is the text of the inline scripts.
+	scripts string
+	// assets are the URLs of the scripts, stylesheets, images and frames
+	// the page loads, but not the pages it links to.
+	assets string
+	// generators are the contents of the generator meta tags.
+	generators string
+	// text is the whole page.
+	text string
+}
+
+func newPlatformPage(body []byte) landingPage {
+	out := landingPage{
+		text: strings.ToLower(string(body)),
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return out
+	}
+
+	scripts := []string{}
+	doc.Find("script").Each(func(i int, s *goquery.Selection) {
+		if _, ok := s.Attr("src"); !ok {
+			scripts = append(scripts, s.Text())
+		}
+	})
+
+	assets := []string{}
+	doc.Find("script[src], link[href], img[src], iframe[src], source[src]").Each(func(i int, s *goquery.Selection) {
+		for _, attr := range []string{"src", "href"} {
+			if v, ok := s.Attr(attr); ok {
+				assets = append(assets, v)
+			}
+		}
+	})
+
+	generators := []string{}
+	doc.Find("meta[name][content]").Each(func(i int, s *goquery.Selection) {
+		if name, _ := s.Attr("name"); strings.EqualFold(name, "generator") {
+			content, _ := s.Attr("content")
+			generators = append(generators, content)
+		}
+	})
+
+	out.scripts = strings.ToLower(strings.Join(scripts, "\n"))
+	out.assets = strings.ToLower(strings.Join(assets, "\n"))
+	out.generators = strings.ToLower(strings.Join(generators, "\n"))
+
+	return out
+}
+
+// DetectPlatform fingerprints a dealer's landing page from its script
+// globals, asset hosts, generator meta tags and response headers. Script
+// globals and asset hosts which are only mentioned in the page's text or
+// links count for less, and a platform found only that way is reported as
+// unknown, so that a page which merely links to a platform's website isn't
+// taken for one built on it. header may be nil if the headers are not
+// available.
+func DetectPlatform(header http.Header, body []byte) PlatformDetection {
+	page := newPlatformPage(body)
+
+	scores := map[Platform]float64{}
+	signals := map[Platform][]string{}
+	// Platforms only mentioned in the page's text aren't reported.
+	found := map[Platform]bool{}
+
+	for _, fp := range fingerprints {
+		value := strings.ToLower(fp.value)
+		weight := fp.weight
+		signal := fmt.Sprintf("%s %s", fp.kind, fp.value)
+		matched := false
+		inText := false
+
+		switch fp.kind {
+		case fingerprintScriptGlobal:
+			matched = strings.Contains(page.scripts, value)
+		case fingerprintAssetHost:
+			matched = strings.Contains(page.assets, value) || strings.Contains(page.scripts, value)
+		case fingerprintGenerator:
+			matched = strings.Contains(page.generators, value)
+		case fingerprintHeader:
+			matched = headerContains(header, fp.value)
+		}
+
+		if !matched && (fp.kind == fingerprintScriptGlobal || fp.kind == fingerprintAssetHost) && strings.Contains(page.text, value) {
+			matched = true
+			inText = true
+			weight *= pageTextWeight
+			signal = fmt.Sprintf("page text %s", fp.value)
+		}
+
+		if !matched {
+			continue
+		}
+
+		if !inText {
+			found[fp.platform] = true
+		}
+
+		scores[fp.platform] += weight
+		signals[fp.platform] = append(signals[fp.platform], signal)
+	}
+
+	out := PlatformDetection{
+		Platform: PlatformUnknown,
+	}
+
+	platforms := []Platform{}
+	for platform := range scores {
+		if found[platform] {
+			platforms = append(platforms, platform)
+		}
+	}
+
+	// Sort so ties are broken the same way every time.
+	sort.Slice(platforms, func(i, j int) bool {
+		if scores[platforms[i]] == scores[platforms[j]] {
+			return platforms[i] < platforms[j]
+		}
+
+		return scores[platforms[i]] > scores[platforms[j]]
+	})
+
+	if len(platforms) == 0 {
+		return out
+	}
+
+	best := platforms[0]
+	out.Platform = best
+	out.Signals = signals[best]
+	out.Confidence = math.Round(scores[best]*100) / 100
+	if out.Confidence > 1 {
+		out.Confidence = 1
+	}
+
+	return out
+}
+
+// headerContains checks a fingerprint of the form "Header-Name: substring".
+func headerContains(header http.Header, fp string) bool {
+	if header == nil {
+		return false
+	}
+
+	parts := strings.SplitN(fp, ":", 2)
+	values := header.Values(strings.TrimSpace(parts[0]))
+	if len(values) == 0 {
+		return false
+	}
+
+	want := strings.ToLower(strings.TrimSpace(parts[1]))
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), want) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+package dealer
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	testCases := []struct {
+		name           string
+		fixture        string
+		header         http.Header
+		wantPlatform   Platform
+		wantConfidence float64
+	}{
+		{
+			name:           "dealer.com",
+			fixture:        "platform/dealer.com.html",
+			header:         http.Header{"X-Ddc-Proxy-Host": {"smithsubaru.com"}},
+			wantPlatform:   PlatformDealerCom,
+			wantConfidence: 1,
+		},
+		{
+			name:           "dealer inspire",
+			fixture:        "platform/dealerinspire.html",
+			wantPlatform:   PlatformDealerInspire,
+			wantConfidence: 1,
+		},
+		{
+			// The names in the script src and the link only count
+			// as page text.
+			name:           "dealeron",
+			fixture:        "platform/dealeron.html",
+			wantPlatform:   PlatformDealerOn,
+			wantConfidence: 0.98,
+		},
+		{
+			name:           "sincro",
+			fixture:        "platform/sincro.html",
+			wantPlatform:   PlatformSincro,
+			wantConfidence: 0.7,
+		},
+		{
+			name:           "dealerfire",
+			fixture:        "platform/dealerfire.html",
+			wantPlatform:   PlatformDealerFire,
+			wantConfidence: 1,
+		},
+		{
+			name:           "header only",
+			header:         http.Header{"X-Cdk-Site": {"green-subaru"}},
+			wantPlatform:   PlatformSincro,
+			wantConfidence: 0.5,
+		},
+		{
+			// A page which mentions and links to platforms isn't
+			// built on any of them.
+			name:           "mentions",
+			fixture:        "platform/mentions.html",
+			wantPlatform:   PlatformUnknown,
+			wantConfidence: 0,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			body := []byte("<html></html>")
+			if testCase.fixture != "" {
+				body = readFixture(t, testCase.fixture)
+			}
+
+			got := DetectPlatform(testCase.header, body)
+			if got.Platform != testCase.wantPlatform || got.Confidence != testCase.wantConfidence {
+				t.Errorf("expected %s with confidence %v, got %s with confidence %v (signals: %v)", testCase.wantPlatform, testCase.wantConfidence, got.Platform, got.Confidence, got.Signals)
+			}
+		})
+	}
+}
+
+func TestDetectPlatformSignals(t *testing.T) {
+	got := DetectPlatform(nil, readFixture(t, "platform/dealeron.html"))
+
+	want := map[string]bool{
+		"page text DealerOn":        true,
+		"script global DlronGlobal": true,
+		"asset host dealeron.com":   true,
+		"page text /searchnew.aspx": true,
+	}
+
+	if len(got.Signals) != len(want) {
+		t.Fatalf("expected signals %v, got %v", want, got.Signals)
+	}
+
+	for _, signal := range got.Signals {
+		if !want[signal] {
+			t.Errorf("unexpected signal %q", signal)
+		}
+	}
+}
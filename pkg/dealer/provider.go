@@ -0,0 +1,174 @@
+package dealer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	aggError "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// InventoryQuery describes the vehicles to look for in a dealer's inventory.
+type InventoryQuery struct {
+	Make         string   `json:"make"`
+	Models       []string `json:"models,omitempty"`
+	Transmission string   `json:"transmission,omitempty"`
+}
+
+// InventoryProvider fetches a dealer's inventory from a particular website
+// platform and normalizes it into Vehicles.
+type InventoryProvider interface {
+	// Name identifies the provider in logs and on each Vehicle it returns.
+	Name() string
+	// GetInventory returns the new and used vehicles matching the query.
+	GetInventory(d DealerResponse, query InventoryQuery) ([]Vehicle, error)
+}
+
+func init() {
+	ddc := &DDCProvider{}
+
+	RegisterInventoryProvider(PlatformDealerCom, ddc)
+	RegisterInventoryProvider(PlatformDealerInspire, &DealerInspireProvider{})
+
+	// We don't always know a dealer's platform, e.g. when it was read from
+	// an old file, and most dealers are on Dealer.com, so try that first.
+	SetFallbackInventoryProvider(&ChainProvider{
+		Providers: []InventoryProvider{ddc, &ListingPageProvider{}},
+	})
+}
+
+var (
+	providersMu      sync.RWMutex
+	providers        = map[Platform]InventoryProvider{}
+	fallbackProvider InventoryProvider
+)
+
+// RegisterInventoryProvider sets the provider used for dealers on the given
+// platform, replacing any existing one.
+func RegisterInventoryProvider(platform Platform, p InventoryProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[platform] = p
+}
+
+// SetFallbackInventoryProvider sets the provider used for dealers whose
+// platform has no provider registered.
+func SetFallbackInventoryProvider(p InventoryProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	fallbackProvider = p
+}
+
+// GetInventoryProvider returns the provider for the given platform, or the
+// fallback provider if none is registered for it.
+func GetInventoryProvider(platform Platform) (InventoryProvider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	if p, ok := providers[platform]; ok {
+		return p, nil
+	}
+
+	if fallbackProvider != nil {
+		return fallbackProvider, nil
+	}
+
+	return nil, fmt.Errorf("no inventory provider for platform %s", platform)
+}
+
+// ChainProvider tries each of its providers in turn until one of them finds
+// some vehicles or succeeds.
+type ChainProvider struct {
+	Providers []InventoryProvider
+}
+
+func (c *ChainProvider) Name() string {
+	names := []string{}
+	for _, p := range c.Providers {
+		names = append(names, p.Name())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (c *ChainProvider) GetInventory(d DealerResponse, query InventoryQuery) ([]Vehicle, error) {
+	errs := []error{}
+
+	for _, p := range c.Providers {
+		vehicles, err := p.GetInventory(d, query)
+		if err == nil || len(vehicles) != 0 {
+			return vehicles, err
+		}
+
+		logger.Debug("inventory provider failed, trying the next one", "dealer", d.Name, "provider", p.Name(), "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+
+	return nil, aggError.NewAggregate(errs)
+}
+
+// userAgent is sent with every request to a dealer's website since some of
+// them refuse requests from Go's default user agent.
+const userAgent string = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.55 Safari/537.36"
+
+// fetchPage GETs a page from a dealer's website and returns its body along
+// with the URL it was ultimately served from.
+func fetchPage(client *http.Client, dealerName, pageURL string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, nil, newURLError(dealerName, pageURL, err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, newRequestError(dealerName, pageURL, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, newStatusError(dealerName, pageURL, resp.StatusCode, ErrHTTPStatus)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, newRequestError(dealerName, pageURL, err)
+	}
+
+	return body, resp.Request.URL, nil
+}
+
+var nonPriceChars = regexp.MustCompile(`[^0-9.]`)
+
+// parsePrice turns a price such as "$32,995" into a number, returning 0 if it
+// can't be parsed.
+func parsePrice(price string) float64 {
+	f, err := strconv.ParseFloat(nonPriceChars.ReplaceAllString(price, ""), 64)
+	if err != nil {
+		return 0
+	}
+
+	return f
+}
+
+// normalizeCondition maps the various ways platforms describe a vehicle's
+// condition to ConditionNew or ConditionUsed.
+func normalizeCondition(condition string) string {
+	switch c := strings.ToLower(strings.TrimSpace(condition)); {
+	case c == "new":
+		return ConditionNew
+	case c == "used", c == "pre-owned", c == "preowned", c == "certified", c == "cpo", strings.Contains(c, "certified"):
+		return ConditionUsed
+	default:
+		return c
+	}
+}
@@ -0,0 +1,169 @@
+package dealer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+// DefaultMaxRedirects is how many redirects are followed from a dealer's
+// SiteURL before giving up with ErrTooManyRedirects, unless
+// ByStateOptions.MaxRedirects says otherwise.
+const DefaultMaxRedirects int = 10
+
+// RedirectHop is a single request made while following a dealer's SiteURL to
+// its website. The last hop is the page the dealer ended up on.
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+}
+
+func (r RedirectHop) String() string {
+	return fmt.Sprintf("%s (%d)", r.URL, r.StatusCode)
+}
+
+// FormatRedirects joins the hops into a single line for logs and reports.
+func FormatRedirects(hops []RedirectHop) string {
+	out := []string{}
+	for _, hop := range hops {
+		out = append(out, hop.String())
+	}
+
+	return strings.Join(out, " -> ")
+}
+
+// parkedDomainHosts are the domain parking and for-sale services a lapsed
+// dealer domain tends to end up on.
+var parkedDomainHosts = []string{
+	"above.com",
+	"afternic.com",
+	"bodis.com",
+	"dan.com",
+	"hugedomains.com",
+	"parkingcrew.net",
+	"parklogic.com",
+	"sedo.com",
+	"sedoparking.com",
+}
+
+// followRedirects requests startURL and each redirect after it one at a time
+// so that every hop is recorded. Sites which set a cookie and then redirect
+// back to the same URL are common, so a URL is only treated as a loop the
+// third time it is seen. transport is http.DefaultTransport if nil.
+func followRedirects(dealerName, startURL string, maxRedirects int, transport http.RoundTripper) (*http.Response, []RedirectHop, error) {
+	hops := []RedirectHop{}
+
+	if maxRedirects <= 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, hops, err
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Jar:       jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	seen := map[string]int{}
+	current := startURL
+
+	for {
+		if len(hops) > maxRedirects {
+			return nil, hops, &FetchError{
+				Kind:   ErrTooManyRedirects,
+				Dealer: dealerName,
+				URL:    startURL,
+				Err:    fmt.Errorf("stopped after %d redirects: %s", maxRedirects, FormatRedirects(hops)),
+			}
+		}
+
+		seen[current]++
+		if seen[current] > 2 {
+			return nil, hops, &FetchError{
+				Kind:   ErrRedirectLoop,
+				Dealer: dealerName,
+				URL:    startURL,
+				Err:    fmt.Errorf("%s -> %s", FormatRedirects(hops), current),
+			}
+		}
+
+		resp, err := client.Get(current)
+		if err != nil {
+			return nil, hops, newRequestError(dealerName, current, err)
+		}
+
+		hops = append(hops, RedirectHop{
+			URL:        current,
+			StatusCode: resp.StatusCode,
+		})
+
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			return resp, hops, nil
+		}
+
+		resp.Body.Close()
+
+		next, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			return nil, hops, newSchemaError(dealerName, current, fmt.Errorf("invalid redirect location %q: %w", location, err))
+		}
+
+		current = next.String()
+	}
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// isOffSiteRedirect reports whether the dealer ended up on a different domain
+// than the one it started on, e.g. a dealer group's portal.
+func isOffSiteRedirect(from, to string) bool {
+	fromURL, err := url.Parse(from)
+	if err != nil {
+		return false
+	}
+
+	toURL, err := url.Parse(to)
+	if err != nil {
+		return false
+	}
+
+	return siteDomain(fromURL.Hostname()) != siteDomain(toURL.Hostname())
+}
+
+func isParkedDomain(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	return containsString(parkedDomainHosts, siteDomain(parsed.Hostname()))
+}
+
+// siteDomain is the registrable domain of a hostname, which is what tells
+// whether two hosts belong to the same dealer. Hosts without one, such as
+// localhost, are compared as they are.
+func siteDomain(host string) string {
+	if domain, err := utils.RegistrableDomain(host); err == nil {
+		return domain
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
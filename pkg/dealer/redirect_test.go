@@ -0,0 +1,163 @@
+package dealer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestFollowRedirectsLimit(t *testing.T) {
+	// Every page redirects to the next one.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		http.Redirect(w, r, "/?n="+strconv.Itoa(n+1), http.StatusFound)
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		maxRedirects int
+		wantHops     int
+	}{
+		{maxRedirects: 2, wantHops: 3},
+		{maxRedirects: 0, wantHops: DefaultMaxRedirects + 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(strconv.Itoa(testCase.maxRedirects), func(t *testing.T) {
+			_, hops, err := followRedirects("Smith Subaru", srv.URL+"/?n=0", testCase.maxRedirects, nil)
+			if ErrorKind(err) != ErrTooManyRedirects {
+				t.Fatalf("expected too many redirects, got %v", err)
+			}
+
+			if len(hops) != testCase.wantHops {
+				t.Errorf("expected %d hops, got %d", testCase.wantHops, len(hops))
+			}
+		})
+	}
+}
+
+// newRedirectServer serves a few dealer websites which redirect around, to
+// be reached with newFixtureClient whatever their hostname.
+func newRedirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host + r.URL.Path {
+		case "www.loopsubaru.com/":
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "www.loopsubaru.com/home":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "smithsubaru.com/":
+			http.Redirect(w, r, "http://www.smithsubaru.com/", http.StatusMovedPermanently)
+		case "www.smithsubaru.com/":
+			w.Write([]byte("<html><head><title>Smith Subaru</title></head></html>"))
+		case "www.smithsubarueast.com/":
+			http.Redirect(w, r, "http://www.smithautogroup.com/subaru-east", http.StatusFound)
+		case "www.smithautogroup.com/subaru-east":
+			w.Write([]byte("<html><head><title>Smith Auto Group</title></head></html>"))
+		case "www.joneslapsed.com/":
+			http.Redirect(w, r, "http://www.sedo.com/search/details/?domain=joneslapsed.com", http.StatusFound)
+		case "www.sedo.com/search/details/":
+			w.Write([]byte("<html><head><title>joneslapsed.com is for sale</title></head></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestFollowRedirectsLoop(t *testing.T) {
+	srv := newRedirectServer(t)
+
+	_, hops, err := followRedirects("Loop Subaru", "http://www.loopsubaru.com/", 0, newFixtureClient(srv).Transport)
+	if ErrorKind(err) != ErrRedirectLoop {
+		t.Fatalf("expected a redirect loop, got %v", err)
+	}
+
+	// Each URL is allowed twice for sites which set a cookie and redirect
+	// back, so the loop is only noticed on the third visit.
+	want := []RedirectHop{
+		{URL: "http://www.loopsubaru.com/", StatusCode: http.StatusFound},
+		{URL: "http://www.loopsubaru.com/home", StatusCode: http.StatusFound},
+		{URL: "http://www.loopsubaru.com/", StatusCode: http.StatusFound},
+		{URL: "http://www.loopsubaru.com/home", StatusCode: http.StatusFound},
+	}
+
+	if !reflect.DeepEqual(hops, want) {
+		t.Errorf("expected hops %v, got %v", want, hops)
+	}
+}
+
+func TestProbeDealerSiteRedirects(t *testing.T) {
+	srv := newRedirectServer(t)
+	opts := ByStateOptions{Transport: newFixtureClient(srv).Transport}
+
+	testCases := []struct {
+		name        string
+		siteURL     string
+		wantKind    error
+		wantSiteURL string
+		wantOffSite bool
+		wantHops    []RedirectHop
+	}{
+		{
+			name:        "same site",
+			siteURL:     "http://smithsubaru.com/",
+			wantSiteURL: "http://www.smithsubaru.com/",
+			wantHops: []RedirectHop{
+				{URL: "http://smithsubaru.com/", StatusCode: http.StatusMovedPermanently},
+				{URL: "http://www.smithsubaru.com/", StatusCode: http.StatusOK},
+			},
+		},
+		{
+			name:        "off site",
+			siteURL:     "http://www.smithsubarueast.com/",
+			wantSiteURL: "http://www.smithautogroup.com/subaru-east",
+			wantOffSite: true,
+			wantHops: []RedirectHop{
+				{URL: "http://www.smithsubarueast.com/", StatusCode: http.StatusFound},
+				{URL: "http://www.smithautogroup.com/subaru-east", StatusCode: http.StatusOK},
+			},
+		},
+		{
+			name:        "parked domain",
+			siteURL:     "http://www.joneslapsed.com/",
+			wantKind:    ErrParkedDomain,
+			wantSiteURL: "http://www.sedo.com/search/details/?domain=joneslapsed.com",
+			wantOffSite: true,
+			wantHops: []RedirectHop{
+				{URL: "http://www.joneslapsed.com/", StatusCode: http.StatusFound},
+				{URL: "http://www.sedo.com/search/details/?domain=joneslapsed.com", StatusCode: http.StatusOK},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			probe, err := probeDealerSite(DealerResponse{Name: "Smith Subaru", SiteURL: testCase.siteURL}, opts)
+			if testCase.wantKind == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			if testCase.wantKind != nil && ErrorKind(err) != testCase.wantKind {
+				t.Fatalf("expected %v, got %v", testCase.wantKind, err)
+			}
+
+			if probe.siteURL != testCase.wantSiteURL {
+				t.Errorf("expected to end up on %s, got %s", testCase.wantSiteURL, probe.siteURL)
+			}
+
+			if probe.offSite != testCase.wantOffSite {
+				t.Errorf("expected off site %v, got %v", testCase.wantOffSite, probe.offSite)
+			}
+
+			if !reflect.DeepEqual(probe.redirects, testCase.wantHops) {
+				t.Errorf("expected hops %v, got %v", testCase.wantHops, probe.redirects)
+			}
+		})
+	}
+}
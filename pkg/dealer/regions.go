@@ -0,0 +1,207 @@
+package dealer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownRegion is returned for a state, province or region name which
+// isn't in the list below.
+var ErrUnknownRegion = errors.New("unknown state, province or region")
+
+const (
+	CountryUS string = "US"
+	CountryCA string = "CA"
+)
+
+// AllRegions can be given instead of a state to mean every state, territory
+// and province.
+const AllRegions string = "all"
+
+// Region is a US state or territory or a Canadian province or territory.
+type Region struct {
+	Code    string
+	Name    string
+	Country string
+}
+
+var regions = []Region{
+	{"AL", "Alabama", CountryUS},
+	{"AK", "Alaska", CountryUS},
+	{"AZ", "Arizona", CountryUS},
+	{"AR", "Arkansas", CountryUS},
+	{"CA", "California", CountryUS},
+	{"CO", "Colorado", CountryUS},
+	{"CT", "Connecticut", CountryUS},
+	{"DE", "Delaware", CountryUS},
+	{"DC", "District of Columbia", CountryUS},
+	{"FL", "Florida", CountryUS},
+	{"GA", "Georgia", CountryUS},
+	{"HI", "Hawaii", CountryUS},
+	{"ID", "Idaho", CountryUS},
+	{"IL", "Illinois", CountryUS},
+	{"IN", "Indiana", CountryUS},
+	{"IA", "Iowa", CountryUS},
+	{"KS", "Kansas", CountryUS},
+	{"KY", "Kentucky", CountryUS},
+	{"LA", "Louisiana", CountryUS},
+	{"ME", "Maine", CountryUS},
+	{"MD", "Maryland", CountryUS},
+	{"MA", "Massachusetts", CountryUS},
+	{"MI", "Michigan", CountryUS},
+	{"MN", "Minnesota", CountryUS},
+	{"MS", "Mississippi", CountryUS},
+	{"MO", "Missouri", CountryUS},
+	{"MT", "Montana", CountryUS},
+	{"NE", "Nebraska", CountryUS},
+	{"NV", "Nevada", CountryUS},
+	{"NH", "New Hampshire", CountryUS},
+	{"NJ", "New Jersey", CountryUS},
+	{"NM", "New Mexico", CountryUS},
+	{"NY", "New York", CountryUS},
+	{"NC", "North Carolina", CountryUS},
+	{"ND", "North Dakota", CountryUS},
+	{"OH", "Ohio", CountryUS},
+	{"OK", "Oklahoma", CountryUS},
+	{"OR", "Oregon", CountryUS},
+	{"PA", "Pennsylvania", CountryUS},
+	{"RI", "Rhode Island", CountryUS},
+	{"SC", "South Carolina", CountryUS},
+	{"SD", "South Dakota", CountryUS},
+	{"TN", "Tennessee", CountryUS},
+	{"TX", "Texas", CountryUS},
+	{"UT", "Utah", CountryUS},
+	{"VT", "Vermont", CountryUS},
+	{"VA", "Virginia", CountryUS},
+	{"WA", "Washington", CountryUS},
+	{"WV", "West Virginia", CountryUS},
+	{"WI", "Wisconsin", CountryUS},
+	{"WY", "Wyoming", CountryUS},
+
+	{"AS", "American Samoa", CountryUS},
+	{"GU", "Guam", CountryUS},
+	{"MP", "Northern Mariana Islands", CountryUS},
+	{"PR", "Puerto Rico", CountryUS},
+	{"VI", "U.S. Virgin Islands", CountryUS},
+
+	{"AB", "Alberta", CountryCA},
+	{"BC", "British Columbia", CountryCA},
+	{"MB", "Manitoba", CountryCA},
+	{"NB", "New Brunswick", CountryCA},
+	{"NL", "Newfoundland and Labrador", CountryCA},
+	{"NS", "Nova Scotia", CountryCA},
+	{"NT", "Northwest Territories", CountryCA},
+	{"NU", "Nunavut", CountryCA},
+	{"ON", "Ontario", CountryCA},
+	{"PE", "Prince Edward Island", CountryCA},
+	{"QC", "Quebec", CountryCA},
+	{"SK", "Saskatchewan", CountryCA},
+	{"YT", "Yukon", CountryCA},
+}
+
+// regionGroups are the names accepted by --region. The US ones follow the
+// Census Bureau regions.
+var regionGroups = map[string][]string{
+	"northeast":   {"CT", "ME", "MA", "NH", "RI", "VT", "NJ", "NY", "PA"},
+	"midwest":     {"IL", "IN", "MI", "OH", "WI", "IA", "KS", "MN", "MO", "NE", "ND", "SD"},
+	"south":       {"DE", "DC", "FL", "GA", "MD", "NC", "SC", "VA", "WV", "AL", "KY", "MS", "TN", "AR", "LA", "OK", "TX"},
+	"west":        {"AZ", "CO", "ID", "MT", "NV", "NM", "UT", "WY", "AK", "CA", "HI", "OR", "WA"},
+	"territories": {"AS", "GU", "MP", "PR", "VI"},
+	"atlantic":    {"NB", "NL", "NS", "PE"},
+	"central":     {"ON", "QC"},
+	"prairies":    {"AB", "MB", "SK"},
+	"pacific":     {"BC"},
+	"north":       {"NT", "NU", "YT"},
+	"us":          regionCodes(CountryUS),
+	"canada":      regionCodes(CountryCA),
+}
+
+func regionCodes(country string) []string {
+	out := []string{}
+	for _, r := range regions {
+		if r.Country == country {
+			out = append(out, r.Code)
+		}
+	}
+
+	return out
+}
+
+// LookupRegion returns the state or province with the given two-letter code
+// or name.
+func LookupRegion(code string) (Region, bool) {
+	code = strings.TrimSpace(code)
+
+	for _, r := range regions {
+		if strings.EqualFold(r.Code, code) || strings.EqualFold(r.Name, code) {
+			return r, true
+		}
+	}
+
+	return Region{}, false
+}
+
+// GetRegionGroupNames returns the names accepted by ResolveRegions.
+func GetRegionGroupNames() []string {
+	out := []string{}
+	for name := range regionGroups {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// ResolveRegions expands state codes, "all" and region group names into a
+// list of state and province codes, in the order given and without
+// duplicates. Every unknown code is reported together.
+func ResolveRegions(states, groups []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]struct{}{}
+	unknown := []string{}
+
+	add := func(codes ...string) {
+		for _, code := range codes {
+			if _, ok := seen[code]; !ok {
+				seen[code] = struct{}{}
+				out = append(out, code)
+			}
+		}
+	}
+
+	for _, state := range states {
+		if strings.EqualFold(strings.TrimSpace(state), AllRegions) {
+			for _, r := range regions {
+				add(r.Code)
+			}
+			continue
+		}
+
+		r, ok := LookupRegion(state)
+		if !ok {
+			unknown = append(unknown, state)
+			continue
+		}
+
+		add(r.Code)
+	}
+
+	for _, group := range groups {
+		codes, ok := regionGroups[strings.ToLower(strings.TrimSpace(group))]
+		if !ok {
+			unknown = append(unknown, group)
+			continue
+		}
+
+		add(codes...)
+	}
+
+	if len(unknown) != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRegion, strings.Join(unknown, ", "))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package dealer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const subaruLocatorBaseURL string = "https://www.subaru.com/services/dealers"
+
+// subaruMaxZipResults is how many dealers are asked for in a ZIP code search
+// before the radius is applied.
+const subaruMaxZipResults int = 50
+
+// SubaruLocator looks dealers up with the subaru.com dealer search.
+type SubaruLocator struct {
+	// Client is used for every request, http.DefaultClient if nil.
+	Client *http.Client
+	// BaseURL overrides https://www.subaru.com/services/dealers. It is used
+	// to replay recorded responses.
+	BaseURL string
+}
+
+func (s *SubaruLocator) Name() string {
+	return "subaru.com"
+}
+
+func (s *SubaruLocator) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (s *SubaruLocator) endpoint(path string, params url.Values) string {
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = subaruLocatorBaseURL
+	}
+
+	params.Set("type", "Active")
+
+	return fmt.Sprintf("%s/%s?%s", strings.TrimRight(baseURL, "/"), path, params.Encode())
+}
+
+func (s *SubaruLocator) ByState(state string) ([]DealerResponse, error) {
+	out := []DealerResponse{}
+
+	u := s.endpoint("by/state", url.Values{"state": []string{state}})
+	if err := getLocatorJSON(s.client(), u, &out); err != nil {
+		return out, fmt.Errorf("could not retrieve dealers in %s: %w", state, err)
+	}
+
+	return out, nil
+}
+
+type subaruDealerDistance struct {
+	Dealer   DealerResponse `json:"dealer"`
+	Distance float64        `json:"distance"`
+}
+
+func (s *SubaruLocator) ByZip(zip string, radius int) ([]DealerResponse, error) {
+	results := []subaruDealerDistance{}
+
+	u := s.endpoint("distances/by/zipcode", url.Values{
+		"zipcode": []string{zip},
+		"count":   []string{strconv.Itoa(subaruMaxZipResults)},
+	})
+
+	if err := getLocatorJSON(s.client(), u, &results); err != nil {
+		return nil, fmt.Errorf("could not retrieve dealers near %s: %w", zip, err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+
+	out := []DealerResponse{}
+	for _, result := range results {
+		if radius > 0 && result.Distance > float64(radius) {
+			break
+		}
+
+		out = append(out, result.Dealer)
+	}
+
+	return out, nil
+}
+
+func (s *SubaruLocator) ByID(id string) (DealerResponse, error) {
+	out := DealerResponse{}
+
+	u := s.endpoint("by/id", url.Values{"id": []string{id}})
+	if err := getLocatorJSON(s.client(), u, &out); err != nil {
+		return out, fmt.Errorf("could not retrieve dealer %s: %w", id, err)
+	}
+
+	if out.ID == "" {
+		return out, fmt.Errorf("could not retrieve dealer %s: %w", id, ErrDealerNotFound)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package dealer
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func newSubaruFixtureLocator(t *testing.T) (*locatorServer, *SubaruLocator) {
+	s, srv := newLocatorServer(t, map[string]func(url.Values) string{
+		"/by/state": func(q url.Values) string {
+			if q.Get("state") == "PA" {
+				return "subaru/by-state-pa.json"
+			}
+			return ""
+		},
+		"/distances/by/zipcode": func(q url.Values) string {
+			if q.Get("zipcode") == "19103" {
+				return "subaru/distances-by-zipcode-19103.json"
+			}
+			return ""
+		},
+		"/by/id": func(q url.Values) string {
+			if q.Get("id") == "041236" {
+				return "subaru/by-id-041236.json"
+			}
+			return "subaru/by-id-missing.json"
+		},
+	})
+
+	return s, &SubaruLocator{Client: srv.Client(), BaseURL: srv.URL}
+}
+
+func TestSubaruLocatorByState(t *testing.T) {
+	s, l := newSubaruFixtureLocator(t)
+
+	dealers, err := l.ByState("PA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dealerIDs(dealers); !reflect.DeepEqual(got, []string{"041236", "041377"}) {
+		t.Fatalf("expected both PA dealers, got %v", got)
+	}
+
+	want := DealerResponse{
+		ID:          "041236",
+		Name:        "Smith Subaru",
+		PhoneNumber: "(610) 555-0123",
+		SiteURL:     "https://www.smithsubaru.com",
+		Types:       []string{"Sales", "Service", "Parts"},
+		Address: Address{
+			Street:  "300 Lancaster Ave",
+			City:    "Wayne",
+			State:   "PA",
+			Zipcode: "19087",
+		},
+		Location: Location{
+			Latitude:  40.0437,
+			Longitude: -75.3877,
+			Region:    "Eastern",
+			Zone:      "Mid-Atlantic",
+			District:  "PA2",
+		},
+	}
+
+	if !reflect.DeepEqual(dealers[0], want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, dealers[0])
+	}
+
+	if got := s.queries[0].Get("type"); got != "Active" {
+		t.Errorf("expected only active dealers to be asked for, got type %q", got)
+	}
+}
+
+func TestSubaruLocatorByZip(t *testing.T) {
+	testCases := []struct {
+		name   string
+		radius int
+		want   []string
+	}{
+		{
+			name:   "sorted by distance",
+			radius: 0,
+			want:   []string{"041236", "041377"},
+		},
+		{
+			name:   "within radius",
+			radius: 25,
+			want:   []string{"041236"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s, l := newSubaruFixtureLocator(t)
+
+			dealers, err := l.ByZip("19103", testCase.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := dealerIDs(dealers); !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("expected %v, got %v", testCase.want, got)
+			}
+
+			if got := s.queries[0].Get("count"); got != strconv.Itoa(subaruMaxZipResults) {
+				t.Errorf("expected %d results to be asked for, got %s", subaruMaxZipResults, got)
+			}
+		})
+	}
+}
+
+func TestSubaruLocatorByID(t *testing.T) {
+	_, l := newSubaruFixtureLocator(t)
+
+	d, err := l.ByID("041236")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Name != "Smith Subaru" || d.SiteURL != "https://www.smithsubaru.com" {
+		t.Errorf("expected Smith Subaru, got %+v", d)
+	}
+
+	if _, err := l.ByID("999999"); !errors.Is(err, ErrDealerNotFound) {
+		t.Errorf("expected an unknown dealer not to be found, got %v", err)
+	}
+}
+
+func TestSubaruLocatorHTTPError(t *testing.T) {
+	_, l := newSubaruFixtureLocator(t)
+
+	if _, err := l.ByState("NJ"); ErrorKind(err) != ErrHTTPStatus {
+		t.Errorf("expected an HTTP status error, got %v", err)
+	}
+}
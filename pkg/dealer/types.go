@@ -2,24 +2,76 @@ package dealer
 
 import "strings"
 
-// Except for the Dealer, DealerStream and DealerResponseStream structs,
-// everything in this file is autogenerated.
+// Except for the Dealer, DealerStream, DealerResponseStream and Vehicle
+// structs, everything in this file is autogenerated.
 
 type DealerStream struct {
 	Dealer
-	Err error
+	// DNSNames are the names on the certificate of the dealer's website.
+	DNSNames []string
+	// Stage is where Err happened.
+	Stage Stage
+	Err   error
 }
 
 type DealerResponseStream struct {
 	DealerResponse
 	DNSNames []string
+	Stage    Stage
 	Err      error
 }
 
 type Dealer struct {
-	Dealer DealerResponse    `json:"dealer"`
-	New    InventoryResponse `json:"new"`
-	Used   InventoryResponse `json:"used"`
+	Dealer   DealerResponse `json:"dealer"`
+	Provider string         `json:"provider,omitempty"`
+	Vehicles []Vehicle      `json:"vehicles"`
+}
+
+const (
+	ConditionNew  string = "new"
+	ConditionUsed string = "used"
+)
+
+// How much a Vehicle's details can be trusted. Vehicles from a platform's
+// inventory API are ConfidenceAPI while ones scraped out of HTML are
+// ConfidenceScraped.
+const (
+	ConfidenceAPI     float64 = 1.0
+	ConfidenceScraped float64 = 0.5
+)
+
+// Vehicle is a single vehicle from a dealer's inventory, normalized from
+// whichever InventoryProvider found it.
+type Vehicle struct {
+	VIN           string  `json:"vin,omitempty"`
+	Condition     string  `json:"condition"`
+	Certified     bool    `json:"certified,omitempty"`
+	Year          int     `json:"year,omitempty"`
+	Make          string  `json:"make,omitempty"`
+	Model         string  `json:"model,omitempty"`
+	Trim          string  `json:"trim,omitempty"`
+	BodyStyle     string  `json:"bodyStyle,omitempty"`
+	ExteriorColor string  `json:"exteriorColor,omitempty"`
+	InteriorColor string  `json:"interiorColor,omitempty"`
+	Transmission  string  `json:"transmission,omitempty"`
+	MSRP          float64 `json:"msrp,omitempty"`
+	Price         float64 `json:"price,omitempty"`
+	Link          string  `json:"link,omitempty"`
+	Provider      string  `json:"provider"`
+	Confidence    float64 `json:"confidence"`
+}
+
+// VehiclesByCondition returns the dealer's vehicles with the given condition.
+func (d Dealer) VehiclesByCondition(condition string) []Vehicle {
+	out := []Vehicle{}
+
+	for _, v := range d.Vehicles {
+		if v.Condition == condition {
+			out = append(out, v)
+		}
+	}
+
+	return out
 }
 
 type DealerResponse struct {
@@ -32,6 +84,45 @@ type DealerResponse struct {
 	SiteURL            string   `json:"siteUrl,omitempty"`
 	Types              []string `json:"types,omitempty"`
 	Location           Location `json:"location,omitempty"`
+	Hours              Hours    `json:"hours,omitempty"`
+	Brands             []string `json:"brands,omitempty"`
+
+	// Platform is the website platform detected on the dealer's site, if it
+	// has been visited.
+	Platform *PlatformDetection `json:"platform,omitempty"`
+
+	// Redirects is every request made to get from the SiteURL given by
+	// the dealer locator to the dealer's website, which is what SiteURL is
+	// replaced with.
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+
+	// OffSiteRedirect is set when the dealer's website is on a different
+	// domain than the one the dealer locator gave.
+	OffSiteRedirect bool `json:"offSiteRedirect,omitempty"`
+
+	// DataLayer holds every field of the DDC.dataLayer['dealership'] object
+	// when the dealer was extracted from its landing page.
+	DataLayer map[string]interface{} `json:"dataLayer,omitempty"`
+
+	// FieldSources records where each field extracted from a landing page
+	// came from (dataLayer, jsonld or meta), keyed by its JSON name, e.g.
+	// address.city.
+	FieldSources map[string]string `json:"fieldSources,omitempty"`
+
+	// LocatorMakes are the makes whose dealer locators list this dealer.
+	LocatorMakes []string `json:"locatorMakes,omitempty"`
+
+	// CertificateOrganizations are the organizations on the TLS
+	// certificate of the dealer's website.
+	CertificateOrganizations []string `json:"certificateOrganizations,omitempty"`
+
+	// Franchises are the makes the dealer sells as worked out by
+	// ClassifyFranchises.
+	Franchises []Franchise `json:"franchises,omitempty"`
+	// DealerGroup is the dealer group the dealer belongs to, named after
+	// one of its dealers' domains, if it shares a certificate with any
+	// other dealer.
+	DealerGroup string `json:"dealerGroup,omitempty"`
 }
 
 func (d DealerResponse) String() string {
@@ -55,6 +146,16 @@ func (d DealerResponse) String() string {
 	return strings.Join(fields, ", ")
 }
 
+// GetPlatform returns the detected website platform or PlatformUnknown if it
+// hasn't been detected.
+func (d DealerResponse) GetPlatform() Platform {
+	if d.Platform == nil {
+		return PlatformUnknown
+	}
+
+	return d.Platform.Platform
+}
+
 type Address struct {
 	Type    string `json:"type,omitempty"`
 	Street  string `json:"street,omitempty"`
@@ -63,6 +164,12 @@ type Address struct {
 	County  string `json:"county,omitempty"`
 	State   string `json:"state,omitempty"`
 	Zipcode string `json:"zipcode,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+type Hours struct {
+	Sales   []string `json:"sales,omitempty"`
+	Service []string `json:"service,omitempty"`
 }
 
 type Location struct {
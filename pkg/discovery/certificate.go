@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// CertificateInfo describes the TLS connection to a host and the certificate
+// it served.
+type CertificateInfo struct {
+	Subject             string    `json:"subject"`
+	SubjectOrganization []string  `json:"subjectOrganization,omitempty"`
+	Issuer              string    `json:"issuer"`
+	SerialNumber        string    `json:"serialNumber"`
+	Fingerprint         string    `json:"fingerprint"`
+	NotBefore           time.Time `json:"notBefore"`
+	NotAfter            time.Time `json:"notAfter"`
+	SANCount            int       `json:"sanCount"`
+	TLSVersion          string    `json:"tlsVersion"`
+	// Verified is whether the certificate chain is trusted and valid for
+	// the host. VerifyError says why not.
+	Verified    bool   `json:"verified"`
+	VerifyError string `json:"verifyError,omitempty"`
+}
+
+// newCertificateInfo describes the leaf certificate of a connection to host,
+// verifying it against roots (the system roots if nil) since the crawler's
+// own client doesn't, or nil if there isn't one.
+func newCertificateInfo(state *tls.ConnectionState, host string, roots *x509.CertPool) *CertificateInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	leaf := state.PeerCertificates[0]
+
+	info := &CertificateInfo{
+		Subject:             leaf.Subject.CommonName,
+		SubjectOrganization: leaf.Subject.Organization,
+		Issuer:              leaf.Issuer.String(),
+		SerialNumber:        leaf.SerialNumber.Text(16),
+		Fingerprint:         certificateFingerprint(leaf),
+		NotBefore:           leaf.NotBefore,
+		NotAfter:            leaf.NotAfter,
+		SANCount:            len(leaf.DNSNames),
+		TLSVersion:          tls.VersionName(state.Version),
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		info.VerifyError = err.Error()
+	} else {
+		info.Verified = true
+	}
+
+	return info
+}
+
+// Expired reports whether the certificate had expired at now.
+func (ci CertificateInfo) Expired(now time.Time) bool {
+	return now.After(ci.NotAfter)
+}
+
+// ExpiresWithin reports whether the certificate has expired or will expire
+// within d of now.
+func (ci CertificateInfo) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return now.Add(d).After(ci.NotAfter)
+}
@@ -0,0 +1,223 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cheesesashimi/subiescraper/pkg/dealer"
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+const defaultCheckpointInterval = 30 * time.Second
+
+// HostStatus is how far a host got in a crawl.
+type HostStatus string
+
+const (
+	// StatusPending hosts are waiting to be crawled.
+	StatusPending HostStatus = "pending"
+	// StatusInFlight hosts were being crawled when the checkpoint was
+	// saved. They are crawled again when the crawl is resumed.
+	StatusInFlight HostStatus = "in-flight"
+	// StatusVisited hosts were crawled.
+	StatusVisited HostStatus = "visited"
+	// StatusFailed hosts couldn't be fetched.
+	StatusFailed HostStatus = "failed"
+	// StatusDeferred hosts were found beyond the crawl's depth or host
+	// budget. They are reconsidered when the crawl is resumed.
+	StatusDeferred HostStatus = "deferred"
+)
+
+// HostRecord is the progress of a single host in a crawl and how it was
+// discovered.
+type HostRecord struct {
+	Hostname string     `json:"hostname"`
+	Status   HostStatus `json:"status"`
+	// Seed is the seed host the crawl started from to find it.
+	Seed string `json:"seed,omitempty"`
+	// Source is where its seed came from when that is worth recording,
+	// e.g. the Certificate Transparency log entry it was found in.
+	Source string `json:"source,omitempty"`
+	// Depth is how many certificates or links away from its seed it was
+	// found, 0 for the seeds themselves.
+	Depth int `json:"depth"`
+	// Path is every host from the seed to this one.
+	Path []string `json:"path,omitempty"`
+	// From is the host it was found on and Channel is how: on its
+	// certificate or linked from its landing page. Both are empty for
+	// seeds.
+	From    string  `json:"from,omitempty"`
+	Channel Channel `json:"channel,omitempty"`
+	// Certificate is the SHA-256 fingerprint of the certificate it was
+	// found on and LinkScore is how likely the link it was found from was
+	// to be a dealership's.
+	Certificate string  `json:"certificate,omitempty"`
+	LinkScore   float64 `json:"linkScore,omitempty"`
+	// TLS describes the host's own certificate once it has been visited.
+	TLS *CertificateInfo `json:"tls,omitempty"`
+}
+
+// Checkpoint is the saved progress of a crawl, which can be resumed with
+// Crawler.Resume.
+type Checkpoint struct {
+	SavedAt time.Time               `json:"savedAt"`
+	Hosts   []HostRecord            `json:"hosts"`
+	Dealers []dealer.DealerResponse `json:"dealers"`
+	// Edges is the crawler's Graph, if it has one.
+	Edges []GraphEdge `json:"edges,omitempty"`
+}
+
+// LoadCheckpoint reads a checkpoint saved by a crawler. ok is false if there
+// isn't one.
+func LoadCheckpoint(path string) (cp Checkpoint, ok bool, err error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, false, nil
+	}
+
+	if err != nil {
+		return cp, false, err
+	}
+
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return cp, false, fmt.Errorf("could not parse checkpoint %s: %w", path, err)
+	}
+
+	return cp, true, nil
+}
+
+// Save writes the checkpoint to path without ever leaving a partial file
+// behind.
+func (cp Checkpoint) Save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, b, 0644)
+}
+
+// Resume picks a crawl back up from a checkpoint. Pending and in-flight hosts
+// are crawled again with the discovery paths they already had, deferred ones
+// are checked against the budget again, visited and failed ones aren't
+// crawled, and the dealers already extracted are kept so they end up in the
+// next checkpoint. It must be called before Run.
+func (c *Crawler) Resume(cp Checkpoint) {
+	c.initRecords()
+
+	retried := 0
+	for _, h := range cp.Hosts {
+		record := h
+
+		switch h.Status {
+		case StatusPending, StatusInFlight, StatusDeferred:
+			if h.Status == StatusInFlight {
+				retried++
+			}
+
+			record.Status = StatusPending
+			c.resumed = append(c.resumed, record)
+		default:
+			c.Known = append(c.Known, h.Hostname)
+		}
+
+		c.records[h.Hostname] = &record
+	}
+
+	c.dealers = append(c.dealers, cp.Dealers...)
+
+	if c.Graph != nil {
+		for _, h := range cp.Hosts {
+			if h.Status == StatusVisited {
+				c.Graph.AddHost(h.Hostname)
+			}
+		}
+
+		c.Graph.AddEdges(cp.Edges...)
+	}
+
+	logger.Info("resuming crawl from checkpoint", "savedAt", cp.SavedAt, "hosts", len(cp.Hosts), "pending", len(c.resumed), "retried", retried, "dealers", len(cp.Dealers))
+}
+
+// Checkpoint returns the crawl's progress so far.
+func (c *Crawler) Checkpoint() Checkpoint {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+
+	cp := Checkpoint{
+		SavedAt: time.Now(),
+		Hosts:   []HostRecord{},
+		Dealers: append([]dealer.DealerResponse{}, c.dealers...),
+	}
+
+	for _, record := range c.records {
+		cp.Hosts = append(cp.Hosts, *record)
+	}
+
+	sort.Slice(cp.Hosts, func(i, j int) bool {
+		return cp.Hosts[i].Hostname < cp.Hosts[j].Hostname
+	})
+
+	if c.Graph != nil {
+		cp.Edges = c.Graph.Edges()
+	}
+
+	return cp
+}
+
+func (c *Crawler) initRecords() {
+	if c.records == nil {
+		c.records = map[string]*HostRecord{}
+	}
+}
+
+// setRecord must be called with callbackMu held.
+func (c *Crawler) setRecord(record HostRecord) {
+	c.records[record.Hostname] = &record
+}
+
+// setStatus must be called with callbackMu held.
+func (c *Crawler) setStatus(host string, status HostStatus) {
+	record, ok := c.records[host]
+	if !ok {
+		record = &HostRecord{
+			Hostname: host,
+		}
+		c.records[host] = record
+	}
+
+	record.Status = status
+}
+
+func (c *Crawler) saveCheckpoint() {
+	if c.CheckpointPath == "" {
+		return
+	}
+
+	cp := c.Checkpoint()
+	if err := cp.Save(c.CheckpointPath); err != nil {
+		logger.Error("could not save checkpoint", "path", c.CheckpointPath, "error", err)
+		return
+	}
+
+	logger.Debug("saved checkpoint", "path", c.CheckpointPath, "hosts", len(cp.Hosts), "dealers", len(cp.Dealers))
+}
+
+// checkpointEvery saves a checkpoint every interval until done is closed.
+func (c *Crawler) checkpointEvery(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.saveCheckpoint()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,650 @@
+// Package discovery finds car dealer websites by crawling the hostnames on
+// the TLS certificates of the dealer websites already known. Dealer groups
+// tend to put every one of their dealers' domains on the same certificate, so
+// a single dealer leads to the rest of its group.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheesesashimi/subiescraper/pkg/dealer"
+	"github.com/cheesesashimi/subiescraper/pkg/logging"
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+	"github.com/gammazero/workerpool"
+)
+
+const (
+	defaultConcurrency int = 5
+	defaultTimeout         = 10 * time.Second
+
+	defaultMinLinkScore float64 = 0.5
+
+	// maxBodySize is how much of a dealer's landing page is read.
+	maxBodySize int64 = 2 << 20
+
+	userAgent string = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.55 Safari/537.36"
+)
+
+// ErrOutOfTime is returned by Run when the crawl's MaxDuration runs out
+// before every host has been crawled.
+var ErrOutOfTime = errors.New("crawl ran out of time")
+
+var logger = logging.Discard()
+
+// SetLogger sets the logger used by this package. Nothing is logged until this
+// is called.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// Channel is how a host was found from another one.
+type Channel string
+
+const (
+	// ChannelCertificate hosts were on the other host's certificate.
+	ChannelCertificate Channel = "certificate"
+	// ChannelLink hosts were linked from the other host's landing page.
+	ChannelLink Channel = "link"
+)
+
+// HostFilter decides whether a hostname should be crawled. RuleSet.Allowed
+// is one.
+type HostFilter func(host string) bool
+
+// Visit is the result of crawling a single host.
+type Visit struct {
+	HostRecord
+	// DNSNames are the hostnames on its certificate which passed the
+	// filter, whether or not they were already known.
+	DNSNames []string
+	// Links are the websites its landing page links to which passed the
+	// filter and scored high enough to be followed, if FollowLinks is set.
+	Links []dealer.DealerLink
+	// Dealer is the dealer extracted from its landing page. It is only
+	// set if the page could be fetched; DealerErr is set if the dealer
+	// couldn't be extracted from it.
+	Dealer    *dealer.DealerResponse
+	DealerErr error
+	// Err is set if the host couldn't be fetched at all.
+	Err error
+}
+
+// Crawler visits each of its seed hosts, extracts the dealer from its landing
+// page and then does the same for every new hostname on its certificate, if
+// it verified, which passes the filter and, if FollowLinks is set, every website its
+// landing page links to which looks like a dealership. It works
+// breadth-first, so every host one hop away from the seeds is crawled before
+// any host two away, and so on until there are none left or the budget runs
+// out.
+//
+// The callbacks are never called concurrently, so they don't need any
+// locking of their own.
+type Crawler struct {
+	// Seeds are the hostnames to start crawling from.
+	Seeds []string
+	// SeedSources optionally records where seeds came from. It is kept as
+	// the Source of each seed and every host found from it.
+	SeedSources map[string]string
+	// Known are hostnames which have already been found, e.g. by an earlier
+	// crawl. They are neither reported nor crawled again unless they are
+	// also seeds.
+	Known []string
+	// Filter decides which seeds, hostnames on a certificate and linked
+	// hosts are crawled. Every hostname is crawled if it is nil.
+	Filter HostFilter
+	// LinkFilter, if set, is used instead of Filter for linked hosts with
+	// a dealer word in their hostname or link text, such as Smith Motors,
+	// which often don't name a make for Filter to allow.
+	LinkFilter HostFilter
+	// Concurrency is how many hosts are fetched at once, 5 if unset.
+	Concurrency int
+
+	// FollowLinks also crawls the websites linked from each landing page
+	// which score at least MinLinkScore (0.5 if unset) as a dealership,
+	// see dealer.DealerLinks. Dealer groups link to their sister stores,
+	// which aren't always on the same certificate.
+	FollowLinks  bool
+	MinLinkScore float64
+
+	// MaxDepth is how many certificates or links away from a seed to crawl. Hosts
+	// found further away are reported as deferred instead. 0 means no
+	// limit.
+	MaxDepth int
+	// MaxHosts is how many hosts to crawl in total, seeds included. Hosts
+	// found once it has been reached are reported as deferred. 0 means no
+	// limit.
+	MaxHosts int
+	// MaxDuration is how long to crawl for. Hosts which haven't been
+	// crawled when it runs out are left pending and Run returns
+	// ErrOutOfTime. 0 means no limit.
+	MaxDuration time.Duration
+
+	// Client is used for every request. It defaults to one with a 10
+	// second timeout which doesn't verify certificates itself, so hosts
+	// with expired or misconfigured certificates are still crawled and
+	// recorded with Verified set to false.
+	Client *http.Client
+	// Roots are the certificate authorities certificates are verified
+	// against, the system roots if nil.
+	Roots *x509.CertPool
+	// Insecure also crawls the hostnames on certificates which didn't
+	// verify and adds edges for them to the Graph. Anyone can put any name
+	// on a self-signed certificate, so by default nothing is found from
+	// one.
+	Insecure bool
+	// URLForHost is the URL fetched for a host, utils.HostnameToURL if nil.
+	// It is used to point the crawler at test servers.
+	URLForHost func(host string) (string, error)
+
+	// Graph, if set, gets every host which is crawled and an edge from it
+	// to each host on its verified certificates which passes the filter. Linked
+	// hosts are added without an edge since a link doesn't make them part
+	// of the same dealer group.
+	Graph *Graph
+
+	// OnHost is called for every new hostname which passes the filter,
+	// with StatusPending if it will be crawled or StatusDeferred if it is
+	// over budget.
+	OnHost func(HostRecord)
+	// OnVisit is called after each host has been crawled.
+	OnVisit func(Visit)
+
+	// CheckpointPath is where the crawl's progress is saved every
+	// CheckpointInterval (30 seconds if unset) and when it stops. Nothing
+	// is saved if it is empty.
+	CheckpointPath     string
+	CheckpointInterval time.Duration
+
+	// callbackMu serializes the callbacks and guards records, dealers and
+	// admitted.
+	callbackMu sync.Mutex
+	records    map[string]*HostRecord
+	dealers    []dealer.DealerResponse
+	admitted   int
+
+	// resumed are the pending hosts from a checkpoint, which keep their
+	// discovery paths and are crawled before the seeds.
+	resumed []HostRecord
+
+	seenMu sync.Mutex
+	seen   map[string]struct{}
+}
+
+// Run crawls until every host within the budget has been visited,
+// MaxDuration runs out (ErrOutOfTime) or ctx is done (ctx.Err()). The hosts
+// which haven't been visited yet are left pending in the final checkpoint so
+// the crawl can be resumed.
+func (c *Crawler) Run(ctx context.Context) error {
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	interval := c.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	crawlCtx := ctx
+	if c.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		crawlCtx, cancel = context.WithTimeout(ctx, c.MaxDuration)
+		defer cancel()
+	}
+
+	c.initRecords()
+
+	c.seen = map[string]struct{}{}
+	for _, host := range c.Known {
+		c.seen[host] = struct{}{}
+	}
+
+	// The periodic checkpoints are stopped, and the last of them has
+	// finished saving, before the final one is saved so that it can't be
+	// overwritten by an older one.
+	done := make(chan struct{})
+	var checkpointWg sync.WaitGroup
+	if c.CheckpointPath != "" {
+		checkpointWg.Add(1)
+		go func() {
+			defer checkpointWg.Done()
+			c.checkpointEvery(interval, done)
+		}()
+	}
+
+	// Seeds and resumed hosts are crawled even if they are known.
+	frontier := []HostRecord{}
+	queued := map[string]struct{}{}
+	for _, record := range c.resumed {
+		if _, ok := queued[record.Hostname]; !ok {
+			queued[record.Hostname] = struct{}{}
+			frontier = append(frontier, record)
+		}
+	}
+
+	for _, host := range c.Seeds {
+		if _, ok := queued[host]; ok {
+			continue
+		}
+
+		if c.Filter != nil && !c.Filter(host) {
+			logger.Debug("skipping seed rejected by filter", "host", host)
+			continue
+		}
+
+		queued[host] = struct{}{}
+		frontier = append(frontier, HostRecord{
+			Hostname: host,
+			Seed:     host,
+			Source:   c.SeedSources[host],
+			Path:     []string{host},
+		})
+	}
+
+	for host := range queued {
+		c.seen[host] = struct{}{}
+	}
+
+	c.callback(func() {
+		for i := range frontier {
+			frontier[i].Status = c.admit(frontier[i])
+			c.setRecord(frontier[i])
+		}
+	})
+
+	for depth := 0; len(frontier) != 0 && crawlCtx.Err() == nil; depth++ {
+		logger.Info("crawling hosts", "depth", depth, "hosts", len(frontier))
+		frontier = c.crawl(crawlCtx, concurrency, frontier)
+	}
+
+	close(done)
+	checkpointWg.Wait()
+
+	c.saveCheckpoint()
+
+	if ctx.Err() == nil && errors.Is(crawlCtx.Err(), context.DeadlineExceeded) {
+		return ErrOutOfTime
+	}
+
+	return ctx.Err()
+}
+
+// crawl visits the pending hosts in the frontier and returns the hosts newly
+// found on their certificates, which make up the next frontier.
+func (c *Crawler) crawl(ctx context.Context, concurrency int, frontier []HostRecord) []HostRecord {
+	var mu sync.Mutex
+	next := []HostRecord{}
+
+	pool := workerpool.New(concurrency)
+
+	for _, record := range frontier {
+		if record.Status != StatusPending {
+			continue
+		}
+
+		record := record
+		pool.Submit(func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			found := c.visit(ctx, record)
+
+			mu.Lock()
+			defer mu.Unlock()
+			next = append(next, found...)
+		})
+	}
+
+	pool.StopWait()
+
+	return next
+}
+
+// admit decides whether a host will be crawled or is over budget. It must be
+// called with callbackMu held.
+func (c *Crawler) admit(record HostRecord) HostStatus {
+	if c.MaxDepth > 0 && record.Depth > c.MaxDepth {
+		return StatusDeferred
+	}
+
+	if c.MaxHosts > 0 && c.admitted >= c.MaxHosts {
+		return StatusDeferred
+	}
+
+	c.admitted++
+
+	return StatusPending
+}
+
+func (c *Crawler) visit(ctx context.Context, record HostRecord) []HostRecord {
+	start := time.Now()
+	host := record.Hostname
+
+	c.callback(func() {
+		c.setStatus(host, StatusInFlight)
+	})
+
+	visit := Visit{
+		HostRecord: record,
+	}
+
+	f, err := c.fetch(ctx, host)
+	if err != nil && ctx.Err() != nil {
+		// The crawl was stopped partway through, so try this host again
+		// when it's resumed.
+		c.callback(func() {
+			c.setStatus(host, StatusPending)
+		})
+		return nil
+	}
+
+	if err != nil {
+		visit.Err = err
+		visit.Status = StatusFailed
+		logger.Warn("could not fetch dealer website", "host", host, "error", err)
+		c.callback(func() {
+			c.setStatus(host, StatusFailed)
+			if c.OnVisit != nil {
+				c.OnVisit(visit)
+			}
+		})
+		return nil
+	}
+
+	visit.TLS = f.tls
+	certs := f.certs
+	if f.tls != nil && !f.tls.Verified {
+		logger.Warn("certificate did not verify", "host", host, "notAfter", f.tls.NotAfter, "error", f.tls.VerifyError, "insecure", c.Insecure)
+		if !c.Insecure {
+			certs = nil
+		}
+	}
+
+	found := c.findHosts(record, certs)
+	for _, h := range found {
+		visit.DNSNames = append(visit.DNSNames, h.Hostname)
+	}
+
+	if c.FollowLinks {
+		visit.Links = c.findLinks(record, f, found)
+		for _, link := range visit.Links {
+			found = append(found, HostRecord{
+				Hostname:  link.Hostname,
+				Seed:      record.Seed,
+				Source:    record.Source,
+				Depth:     record.Depth + 1,
+				Path:      append(append([]string{}, record.Path...), link.Hostname),
+				From:      host,
+				Channel:   ChannelLink,
+				LinkScore: link.Score,
+			})
+		}
+	}
+
+	if c.Graph != nil {
+		c.Graph.AddHost(host)
+		for _, h := range found {
+			if h.Channel != ChannelCertificate {
+				c.Graph.AddHost(h.Hostname)
+				continue
+			}
+
+			c.Graph.AddEdges(GraphEdge{
+				From:        host,
+				To:          h.Hostname,
+				Certificate: h.Certificate,
+			})
+		}
+	}
+
+	d, err := dealer.GetDealerResponseWithHeaders(bytes.NewReader(f.body), f.header, host)
+	if f.tls != nil {
+		d.CertificateOrganizations = f.tls.SubjectOrganization
+	}
+
+	visit.Dealer = &d
+	visit.DealerErr = err
+	visit.Status = StatusVisited
+
+	logger.Info("crawled dealer website", "host", host, "dealer", d.Name, "platform", d.GetPlatform(), "depth", record.Depth, "dnsNames", len(visit.DNSNames), "links", len(visit.Links), "duration", time.Since(start))
+
+	newHosts := []HostRecord{}
+	for _, h := range found {
+		if c.markSeen(h.Hostname) {
+			newHosts = append(newHosts, h)
+		}
+	}
+
+	c.callback(func() {
+		c.setStatus(host, StatusVisited)
+		c.records[host].TLS = f.tls
+		if err == nil {
+			c.dealers = append(c.dealers, d)
+		}
+
+		if c.OnVisit != nil {
+			c.OnVisit(visit)
+		}
+
+		for i := range newHosts {
+			newHosts[i].Status = c.admit(newHosts[i])
+			c.setRecord(newHosts[i])
+
+			logger.Info("found new host", "host", newHosts[i].Hostname, "channel", newHosts[i].Channel, "path", strings.Join(newHosts[i].Path, " -> "), "status", newHosts[i].Status)
+			if c.OnHost != nil {
+				c.OnHost(newHosts[i])
+			}
+		}
+	})
+
+	return newHosts
+}
+
+func (c *Crawler) callback(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+
+	f()
+}
+
+// markSeen returns true the first time it is called for a host.
+func (c *Crawler) markSeen(host string) bool {
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+
+	if _, ok := c.seen[host]; ok {
+		return false
+	}
+
+	c.seen[host] = struct{}{}
+
+	return true
+}
+
+// findHosts normalizes the names on a host's certificates and drops the host
+// itself and the ones the filter rejects. Each host found extends the
+// discovery path of the one it was found on and keeps the fingerprint of the
+// certificate it was on.
+func (c *Crawler) findHosts(from HostRecord, certs []*x509.Certificate) []HostRecord {
+	out := []HostRecord{}
+	found := map[string]struct{}{}
+
+	for _, cert := range certs {
+		fingerprint := certificateFingerprint(cert)
+
+		for _, dnsName := range cert.DNSNames {
+			// Wildcards are crawled as their registrable domain,
+			// while single labels such as localhost and bare public
+			// suffixes can't be crawled at all.
+			name, err := utils.StripHostname(dnsName)
+			if err != nil {
+				logger.Debug("skipping invalid host", "host", dnsName, "from", from.Hostname, "error", err)
+				continue
+			}
+
+			if name == from.Hostname {
+				continue
+			}
+
+			if _, ok := found[name]; ok {
+				continue
+			}
+
+			if c.Filter != nil && !c.Filter(name) {
+				logger.Debug("skipping host rejected by filter", "host", name, "from", from.Hostname)
+				continue
+			}
+
+			found[name] = struct{}{}
+			out = append(out, HostRecord{
+				Hostname:    name,
+				Seed:        from.Seed,
+				Source:      from.Source,
+				Depth:       from.Depth + 1,
+				Path:        append(append([]string{}, from.Path...), name),
+				From:        from.Hostname,
+				Channel:     ChannelCertificate,
+				Certificate: fingerprint,
+			})
+		}
+	}
+
+	return out
+}
+
+// findLinks returns the websites a host's landing page links to which score
+// high enough, pass the filter and weren't already found on its
+// certificates.
+func (c *Crawler) findLinks(from HostRecord, f fetched, onCertificate []HostRecord) []dealer.DealerLink {
+	minScore := c.MinLinkScore
+	if minScore <= 0 {
+		minScore = defaultMinLinkScore
+	}
+
+	links, err := dealer.DealerLinks(f.body, f.header, from.Hostname)
+	if err != nil {
+		logger.Debug("could not find links", "host", from.Hostname, "error", err)
+		return nil
+	}
+
+	found := map[string]struct{}{}
+	for _, h := range onCertificate {
+		found[h.Hostname] = struct{}{}
+	}
+
+	out := []dealer.DealerLink{}
+	for _, link := range links {
+		if _, ok := found[link.Hostname]; ok {
+			continue
+		}
+
+		if link.Score < minScore {
+			logger.Debug("skipping link which doesn't look like a dealership", "host", link.Hostname, "from", from.Hostname, "score", link.Score, "signals", link.Signals)
+			continue
+		}
+
+		filter := c.Filter
+		if c.LinkFilter != nil && link.HasDealerWord() {
+			filter = c.LinkFilter
+		}
+
+		if filter != nil && !filter(link.Hostname) {
+			logger.Debug("skipping link rejected by filter", "host", link.Hostname, "from", from.Hostname)
+			continue
+		}
+
+		out = append(out, link)
+	}
+
+	return out
+}
+
+// certificateFingerprint is the hex SHA-256 of the certificate, which is how
+// crt.sh and most other tools identify one.
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// fetched is a host's landing page and the certificates it was served with.
+type fetched struct {
+	body   []byte
+	header http.Header
+	certs  []*x509.Certificate
+	tls    *CertificateInfo
+}
+
+func (c *Crawler) fetch(ctx context.Context, host string) (fetched, error) {
+	client := c.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+
+		client = &http.Client{
+			Timeout:   defaultTimeout,
+			Transport: transport,
+		}
+	}
+
+	urlForHost := c.URLForHost
+	if urlForHost == nil {
+		urlForHost = utils.HostnameToURL
+	}
+
+	u, err := urlForHost(host)
+	if err != nil {
+		return fetched{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return fetched{}, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetched{}, fmt.Errorf("could not fetch %s: %w", u, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return fetched{}, fmt.Errorf("could not read %s: %w", u, err)
+	}
+
+	f := fetched{
+		body:   body,
+		header: resp.Header,
+		certs:  []*x509.Certificate{},
+		tls:    newCertificateInfo(resp.TLS, resp.Request.URL.Hostname(), c.Roots),
+	}
+
+	if resp.TLS != nil {
+		for _, cert := range resp.TLS.PeerCertificates {
+			if cert != nil {
+				f.certs = append(f.certs, cert)
+			}
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,554 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSites are the hosts served by the test server and the other names on
+// each of their certificates:
+//
+//	smithsubaru.com (seed)
+//	├── smithtoyota.com
+//	│   └── smithford.com
+//	│       └── smithkia.com
+//	├── smithhonda.com
+//	└── cloudflaressl.com
+var testSites = map[string][]string{
+	"smithsubaru.com":   {"www.smithtoyota.com", "smithhonda.com", "sni.cloudflaressl.com"},
+	"smithtoyota.com":   {"smithford.com"},
+	"smithhonda.com":    {},
+	"smithford.com":     {"*.smithkia.com"},
+	"smithkia.com":      {},
+	"cloudflaressl.com": {},
+	"jonesdealer.com":   {},
+}
+
+// certServer is a TLS server which serves each host with its own
+// certificate, picked by SNI, so that the crawler can be pointed at it with
+// URLForHost and Client.
+type certServer struct {
+	srv   *httptest.Server
+	roots *x509.CertPool
+	certs map[string]*tls.Certificate
+
+	mu   sync.Mutex
+	hits map[string]int
+	// pages are the landing pages of the hosts which have more than their
+	// name on them.
+	pages map[string]string
+}
+
+// newCertServer serves each of the sites with a certificate for it and its
+// other names. The untrusted ones are self-signed, the rest are signed by a
+// root the crawler trusts.
+func newCertServer(t *testing.T, sites map[string][]string, untrusted ...string) *certServer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &certServer{
+		roots: x509.NewCertPool(),
+		certs: map[string]*tls.Certificate{},
+		hits:  map[string]int{},
+	}
+
+	cs.roots.AddCert(ca)
+
+	serial := int64(2)
+	for host, sans := range sites {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: host},
+			DNSNames:     append([]string{host}, sans...),
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		serial++
+
+		parent := ca
+		for _, u := range untrusted {
+			if u == host {
+				parent = template
+			}
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cs.certs[host] = &tls.Certificate{
+			Certificate: [][]byte{der, caDER},
+			PrivateKey:  key,
+		}
+	}
+
+	cs.srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		cs.mu.Lock()
+		cs.hits[host]++
+		page, ok := cs.pages[host]
+		cs.mu.Unlock()
+
+		if ok {
+			fmt.Fprint(w, page)
+			return
+		}
+
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body><h1>%s</h1></body></html>", host, host)
+	}))
+
+	cs.srv.TLS = &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, ok := cs.certs[hello.ServerName]
+			if !ok {
+				return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+			}
+
+			return cert, nil
+		},
+	}
+
+	cs.srv.StartTLS()
+	t.Cleanup(cs.srv.Close)
+
+	return cs
+}
+
+// client dials the test server whatever host it is asked for. Like the
+// crawler's default client it doesn't verify certificates itself.
+func (cs *certServer) client() *http.Client {
+	addr := cs.srv.Listener.Addr().String()
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+}
+
+func (cs *certServer) crawler(seeds ...string) *Crawler {
+	return &Crawler{
+		Seeds:  seeds,
+		Client: cs.client(),
+		Roots:  cs.roots,
+		URLForHost: func(host string) (string, error) {
+			return "https://" + host + "/", nil
+		},
+	}
+}
+
+// requested returns the hosts which have been requested, sorted.
+func (cs *certServer) requested() []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	out := []string{}
+	for host := range cs.hits {
+		out = append(out, host)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+func (cs *certServer) reset() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.hits = map[string]int{}
+}
+
+// statuses returns the hosts in the checkpoint with each status.
+func statuses(cp Checkpoint) map[HostStatus][]string {
+	out := map[HostStatus][]string{}
+	for _, h := range cp.Hosts {
+		out[h.Status] = append(out[h.Status], h.Hostname)
+	}
+
+	return out
+}
+
+func TestCrawlerBreadthFirst(t *testing.T) {
+	cs := newCertServer(t, testSites)
+
+	c := cs.crawler("smithsubaru.com")
+	c.Graph = NewGraph()
+
+	visits := []Visit{}
+	c.OnVisit = func(v Visit) {
+		visits = append(visits, v)
+	}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"cloudflaressl.com", "smithford.com", "smithhonda.com", "smithkia.com", "smithsubaru.com", "smithtoyota.com"}
+	if got := statuses(c.Checkpoint())[StatusVisited]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v to be visited, got %v", want, got)
+	}
+
+	depths := map[string]int{}
+	for i, v := range visits {
+		if i > 0 && v.Depth < visits[i-1].Depth {
+			t.Errorf("expected hosts to be visited breadth-first, %s (depth %d) came after %s (depth %d)", v.Hostname, v.Depth, visits[i-1].Hostname, visits[i-1].Depth)
+		}
+
+		depths[v.Hostname] = v.Depth
+	}
+
+	wantDepths := map[string]int{
+		"smithsubaru.com":   0,
+		"smithtoyota.com":   1,
+		"smithhonda.com":    1,
+		"cloudflaressl.com": 1,
+		"smithford.com":     2,
+		"smithkia.com":      3,
+	}
+
+	if !reflect.DeepEqual(depths, wantDepths) {
+		t.Errorf("expected depths %v, got %v", wantDepths, depths)
+	}
+
+	for _, v := range visits {
+		if v.Hostname != "smithkia.com" {
+			continue
+		}
+
+		wantPath := []string{"smithsubaru.com", "smithtoyota.com", "smithford.com", "smithkia.com"}
+		if !reflect.DeepEqual(v.Path, wantPath) || v.From != "smithford.com" || v.Channel != ChannelCertificate {
+			t.Errorf("expected smithkia.com to be found on smithford.com's certificate via %v, got %+v", wantPath, v.HostRecord)
+		}
+	}
+
+	if got := c.Graph.Groups(); len(got) != 1 || len(got[0]) != len(want) {
+		t.Errorf("expected every host to be in one group, got %v", got)
+	}
+}
+
+func TestCrawlerRuleSetFilter(t *testing.T) {
+	cs := newCertServer(t, testSites)
+
+	rules, err := ParseRules("deny cloudflaressl.com\ndeny smithhonda.com\nallow smith*\ndefault deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cs.crawler("smithsubaru.com", "jonesdealer.com")
+	c.Filter = rules.Allowed
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"smithford.com", "smithkia.com", "smithsubaru.com", "smithtoyota.com"}
+	if got := cs.requested(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected only %v to be requested, got %v", want, got)
+	}
+
+	for _, h := range c.Checkpoint().Hosts {
+		if !rules.Allowed(h.Hostname) {
+			t.Errorf("expected %s to be left out of the checkpoint", h.Hostname)
+		}
+	}
+}
+
+func TestCrawlerLinkFilter(t *testing.T) {
+	cs := newCertServer(t, map[string][]string{
+		"smithsubaru.com": {},
+		"smithmotors.com": {},
+		"smith-cars.com":  {},
+		"smithvolvo.com":  {},
+		"oscars.com":      {},
+	})
+
+	cs.pages = map[string]string{
+		"smithsubaru.com": `<html><body><footer>
+<a href="https://www.smithmotors.com/">Smith Motors Subaru</a>
+<a href="https://www.smith-cars.com/">Smith Cars Subaru</a>
+<a href="https://www.smithvolvo.com/">Smith Volvo</a>
+<a href="https://www.oscars.com/">Oscar's Subaru parts</a>
+</footer></body></html>`,
+	}
+
+	rules, err := ParseRules("deny smith-cars.com\nallow *subaru*\ndefault deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cs.crawler("smithsubaru.com")
+	c.FollowLinks = true
+	c.Filter = rules.Allowed
+	c.LinkFilter = RuleSet{Rules: rules.Rules, Default: Allow}.Allowed
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// smithmotors.com has no make in it but is named like a dealership and
+	// smith-cars.com is denied by a rule. smithvolvo.com has no dealer
+	// word, so Filter applies to it, and oscars.com doesn't either, so it
+	// doesn't score high enough.
+	want := []string{"smithmotors.com", "smithsubaru.com"}
+	if got := cs.requested(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected only %v to be requested, got %v", want, got)
+	}
+
+	cs.reset()
+
+	c = cs.crawler("smithsubaru.com")
+	c.FollowLinks = true
+	c.Filter = rules.Allowed
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"smithsubaru.com"}
+	if got := cs.requested(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected only %v to be requested without a LinkFilter, got %v", want, got)
+	}
+}
+
+func TestCrawlerMaxDepth(t *testing.T) {
+	cs := newCertServer(t, testSites)
+
+	c := cs.crawler("smithsubaru.com")
+	c.MaxDepth = 1
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := statuses(c.Checkpoint())
+
+	wantVisited := []string{"cloudflaressl.com", "smithhonda.com", "smithsubaru.com", "smithtoyota.com"}
+	if !reflect.DeepEqual(got[StatusVisited], wantVisited) {
+		t.Errorf("expected %v to be visited, got %v", wantVisited, got[StatusVisited])
+	}
+
+	// Hosts two hops away are found but not crawled, and nothing is found
+	// from them.
+	wantDeferred := []string{"smithford.com"}
+	if !reflect.DeepEqual(got[StatusDeferred], wantDeferred) {
+		t.Errorf("expected %v to be deferred, got %v", wantDeferred, got[StatusDeferred])
+	}
+}
+
+func TestCrawlerMaxHosts(t *testing.T) {
+	cs := newCertServer(t, testSites)
+
+	c := cs.crawler("smithsubaru.com")
+	c.MaxHosts = 2
+
+	found := []string{}
+	c.OnHost = func(h HostRecord) {
+		found = append(found, fmt.Sprintf("%s:%s", h.Hostname, h.Status))
+	}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The seed and the first name on its certificate use up the budget.
+	if got := cs.requested(); !reflect.DeepEqual(got, []string{"smithsubaru.com", "smithtoyota.com"}) {
+		t.Errorf("expected only two hosts to be requested, got %v", got)
+	}
+
+	want := []string{
+		"smithtoyota.com:pending",
+		"smithhonda.com:deferred",
+		"cloudflaressl.com:deferred",
+		"smithford.com:deferred",
+	}
+
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("expected OnHost to be called with %v, got %v", want, found)
+	}
+}
+
+func TestCrawlerResume(t *testing.T) {
+	cs := newCertServer(t, testSites)
+
+	first := cs.crawler("smithsubaru.com")
+	first.MaxDepth = 1
+
+	if err := first.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cs.reset()
+
+	second := cs.crawler("smithsubaru.com")
+
+	visits := map[string]Visit{}
+	second.OnVisit = func(v Visit) {
+		visits[v.Hostname] = v
+	}
+
+	second.Resume(first.Checkpoint())
+
+	if err := second.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deferred hosts are crawled, along with what is found from them,
+	// while the hosts visited the first time aren't fetched again. The seed
+	// is the exception since seeds are always crawled.
+	want := []string{"smithford.com", "smithkia.com", "smithsubaru.com"}
+	if got := cs.requested(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v to be requested, got %v", want, got)
+	}
+
+	v, ok := visits["smithford.com"]
+	if !ok {
+		t.Fatal("expected smithford.com to be visited")
+	}
+
+	wantPath := []string{"smithsubaru.com", "smithtoyota.com", "smithford.com"}
+	if v.Depth != 2 || !reflect.DeepEqual(v.Path, wantPath) {
+		t.Errorf("expected smithford.com to keep its depth and path %v, got %d and %v", wantPath, v.Depth, v.Path)
+	}
+
+	if got := visits["smithkia.com"].Depth; got != 3 {
+		t.Errorf("expected smithkia.com to be found at depth 3, got %d", got)
+	}
+
+	if got := statuses(second.Checkpoint())[StatusDeferred]; len(got) != 0 {
+		t.Errorf("expected nothing to be left deferred, got %v", got)
+	}
+}
+
+func TestCrawlerFinalCheckpoint(t *testing.T) {
+	cs := newCertServer(t, testSites)
+
+	c := cs.crawler("smithsubaru.com")
+	c.CheckpointPath = filepath.Join(t.TempDir(), "checkpoint.json")
+	c.CheckpointInterval = time.Millisecond
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, ok, err := LoadCheckpoint(c.CheckpointPath)
+	if err != nil || !ok {
+		t.Fatalf("expected a checkpoint, got %v", err)
+	}
+
+	// A periodic checkpoint saved after the final one would still have
+	// hosts pending or in flight.
+	if got, want := statuses(cp), statuses(c.Checkpoint()); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the saved checkpoint to match the finished crawl %v, got %v", want, got)
+	}
+}
+
+func TestCrawlerUnverifiedCertificate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		insecure    bool
+		wantVisited []string
+		wantEdges   int
+	}{
+		{
+			name:        "verified only",
+			wantVisited: []string{"cloudflaressl.com", "smithhonda.com", "smithsubaru.com", "smithtoyota.com"},
+			wantEdges:   3,
+		},
+		{
+			name:        "insecure",
+			insecure:    true,
+			wantVisited: []string{"cloudflaressl.com", "smithford.com", "smithhonda.com", "smithkia.com", "smithsubaru.com", "smithtoyota.com"},
+			wantEdges:   5,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// smithtoyota.com's certificate is self-signed, so anything
+			// could be on it.
+			cs := newCertServer(t, testSites, "smithtoyota.com")
+
+			c := cs.crawler("smithsubaru.com")
+			c.Graph = NewGraph()
+			c.Insecure = testCase.insecure
+
+			var toyota *CertificateInfo
+			c.OnVisit = func(v Visit) {
+				if v.Hostname == "smithtoyota.com" {
+					toyota = v.TLS
+				}
+			}
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// The host itself is still crawled and recorded as
+			// unverified either way.
+			if toyota == nil || toyota.Verified || toyota.VerifyError == "" {
+				t.Errorf("expected smithtoyota.com to be recorded as unverified, got %+v", toyota)
+			}
+
+			if got := statuses(c.Checkpoint())[StatusVisited]; !reflect.DeepEqual(got, testCase.wantVisited) {
+				t.Errorf("expected %v to be visited, got %v", testCase.wantVisited, got)
+			}
+
+			if got := len(c.Graph.Edges()); got != testCase.wantEdges {
+				t.Errorf("expected %d edges, got %d: %v", testCase.wantEdges, got, c.Graph.Edges())
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+// DefaultCTBaseURL is crt.sh, which searches every Certificate Transparency
+// log.
+const DefaultCTBaseURL = "https://crt.sh/"
+
+// ctTimeout is long because crt.sh can take a while to answer broad searches.
+const ctTimeout = 2 * time.Minute
+
+// CTEntry is a certificate found in the Certificate Transparency logs, in
+// the JSON format crt.sh returns with output=json.
+type CTEntry struct {
+	ID         int64  `json:"id"`
+	IssuerName string `json:"issuer_name"`
+	CommonName string `json:"common_name"`
+	// NameValue is the certificate's names, one per line.
+	NameValue    string `json:"name_value"`
+	NotBefore    string `json:"not_before"`
+	NotAfter     string `json:"not_after"`
+	SerialNumber string `json:"serial_number"`
+}
+
+// Names returns every name on the certificate.
+func (e CTEntry) Names() []string {
+	out := []string{}
+	for _, name := range append(strings.Split(e.NameValue, "\n"), e.CommonName) {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+
+	return out
+}
+
+// CTSeed is a host found in the Certificate Transparency logs.
+type CTSeed struct {
+	Hostname string
+	// Source is where it was found, e.g. "crt.sh %subaru% (certificate
+	// 12345)".
+	Source string
+}
+
+// CTPattern is the crt.sh pattern matching every name containing keyword,
+// e.g. %subaru%.
+func CTPattern(keyword string) string {
+	return "%" + keyword + "%"
+}
+
+// MatchCTPattern reports whether a hostname matches a crt.sh pattern, which
+// is a SQL LIKE pattern where % matches any run of characters and _ any one
+// character. It is used to check names from saved results the same way crt.sh
+// would have.
+func MatchCTPattern(pattern, hostname string) bool {
+	var glob strings.Builder
+	for _, r := range strings.ToLower(pattern) {
+		switch r {
+		case '%':
+			glob.WriteByte('*')
+		case '_':
+			glob.WriteByte('?')
+		case '*', '?', '[', '\\':
+			glob.WriteByte('\\')
+			glob.WriteRune(r)
+		default:
+			glob.WriteRune(r)
+		}
+	}
+
+	matched, err := path.Match(glob.String(), strings.ToLower(hostname))
+	return err == nil && matched
+}
+
+// ParseCTEntries reads crt.sh JSON search results.
+func ParseCTEntries(r io.Reader) ([]CTEntry, error) {
+	entries := []CTEntry{}
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("could not parse Certificate Transparency results: %w", err)
+	}
+
+	return entries, nil
+}
+
+// LoadCTEntries reads crt.sh JSON search results saved to a file.
+func LoadCTEntries(path string) ([]CTEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	entries, err := ParseCTEntries(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return entries, nil
+}
+
+// CTSearch searches a crt.sh compatible Certificate Transparency search for
+// certificates with names matching a pattern.
+type CTSearch struct {
+	// BaseURL is DefaultCTBaseURL if empty. It can point at a local
+	// stand-in which serves the same JSON.
+	BaseURL string
+	// Client defaults to one with a 2 minute timeout.
+	Client *http.Client
+}
+
+// Search returns the certificates with a name matching pattern, where % is a
+// wildcard, e.g. %subaru%.
+func (s *CTSearch) Search(ctx context.Context, pattern string) ([]CTEntry, error) {
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultCTBaseURL
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{
+			Timeout: ctTimeout,
+		}
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Certificate Transparency search URL %q: %w", baseURL, err)
+	}
+
+	q := u.Query()
+	q.Set("q", pattern)
+	q.Set("output", "json")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	start := time.Now()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not search %s for %s: %w", u.Host, pattern, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not search %s for %s: HTTP %d - %s", u.Host, pattern, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	entries, err := ParseCTEntries(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", u.Host, pattern, err)
+	}
+
+	logger.Info("searched Certificate Transparency logs", "host", u.Host, "pattern", pattern, "certificates", len(entries), "duration", time.Since(start))
+
+	return entries, nil
+}
+
+// CTSeeds returns the hosts named on the certificates which pass the filter,
+// each once and attributed to the first certificate it was found on. source
+// says where the entries came from, e.g. the search or file.
+func CTSeeds(entries []CTEntry, filter HostFilter, source string) []CTSeed {
+	// Look at the oldest certificates first so that each host is
+	// attributed to the same certificate every time.
+	sorted := append([]CTEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	out := []CTSeed{}
+	found := map[string]struct{}{}
+
+	for _, entry := range sorted {
+		for _, name := range entry.Names() {
+			host, err := utils.StripHostname(name)
+			if err != nil {
+				logger.Debug("skipping invalid name in Certificate Transparency results", "name", name, "certificate", entry.ID, "error", err)
+				continue
+			}
+
+			if _, ok := found[host]; ok {
+				continue
+			}
+
+			found[host] = struct{}{}
+
+			if filter != nil && !filter(host) {
+				continue
+			}
+
+			out = append(out, CTSeed{
+				Hostname: host,
+				Source:   fmt.Sprintf("%s (certificate %d)", source, entry.ID),
+			})
+		}
+	}
+
+	return out
+}
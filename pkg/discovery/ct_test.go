@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCTResults = `[
+	{"id": 30, "issuer_name": "C=US, O=Let's Encrypt, CN=R3", "common_name": "www.smithsubaru.com", "name_value": "smithsubaru.com\nwww.smithsubaru.com", "not_before": "2023-01-01T00:00:00", "not_after": "2023-04-01T00:00:00", "serial_number": "03"},
+	{"id": 10, "issuer_name": "C=US, O=Let's Encrypt, CN=R3", "common_name": "*.jonessubaru.net", "name_value": "*.jonessubaru.net\nJonesSubaru.net\nmail.jonessubaru.net", "not_before": "2022-01-01T00:00:00", "not_after": "2022-04-01T00:00:00", "serial_number": "01"},
+	{"id": 20, "issuer_name": "C=US, O=Let's Encrypt, CN=R3", "common_name": "smithsubaru.com", "name_value": "smithsubaru.com\nsmithtoyota.com\nlocalhost", "not_before": "2022-06-01T00:00:00", "not_after": "2022-09-01T00:00:00", "serial_number": "02"}
+]`
+
+func TestMatchCTPattern(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		hostname string
+		want     bool
+	}{
+		{pattern: "%subaru%", hostname: "smithsubaru.com", want: true},
+		{pattern: "%SUBARU%", hostname: "SmithSubaru.com", want: true},
+		{pattern: "%subaru%", hostname: "smithtoyota.com", want: false},
+		{pattern: "subaru%", hostname: "smithsubaru.com", want: false},
+		{pattern: "%.subaru.com", hostname: "www.subaru.com", want: true},
+		{pattern: "smith_subaru.com", hostname: "smith-subaru.com", want: true},
+		{pattern: "smith_subaru.com", hostname: "smithsubaru.com", want: false},
+		{pattern: "%[subaru]%", hostname: "x[subaru].com", want: true},
+		{pattern: "%[subaru]%", hostname: "s.com", want: false},
+		{pattern: `%\%`, hostname: `a\b`, want: true},
+		{pattern: "*subaru*", hostname: "smithsubaru.com", want: false},
+		{pattern: "sub?ru.com", hostname: "subaru.com", want: false},
+	}
+
+	for _, testCase := range testCases {
+		if got := MatchCTPattern(testCase.pattern, testCase.hostname); got != testCase.want {
+			t.Errorf("MatchCTPattern(%q, %q): expected %v, got %v", testCase.pattern, testCase.hostname, testCase.want, got)
+		}
+	}
+}
+
+func TestParseCTEntries(t *testing.T) {
+	entries, err := ParseCTEntries(strings.NewReader(testCTResults))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	want := []string{"*.jonessubaru.net", "JonesSubaru.net", "mail.jonessubaru.net", "*.jonessubaru.net"}
+	if got := entries[1].Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected names %v, got %v", want, got)
+	}
+
+	if _, err := ParseCTEntries(strings.NewReader(`<html>502 Bad Gateway</html>`)); err == nil {
+		t.Error("expected an error parsing HTML")
+	}
+}
+
+func TestCTSearch(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(testCTResults))
+	}))
+	t.Cleanup(srv.Close)
+
+	search := &CTSearch{BaseURL: srv.URL + "/"}
+
+	entries, err := search.Search(context.Background(), "%subaru%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %d", len(entries))
+	}
+
+	if want := "output=json&q=%25subaru%25"; gotQuery != want {
+		t.Errorf("expected query %q, got %q", want, gotQuery)
+	}
+}
+
+func TestCTSearchError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try again later", http.StatusBadGateway)
+	}))
+	t.Cleanup(srv.Close)
+
+	search := &CTSearch{BaseURL: srv.URL}
+
+	if _, err := search.Search(context.Background(), "%subaru%"); err == nil || !strings.Contains(err.Error(), "HTTP 502") {
+		t.Errorf("expected an HTTP 502 error, got %v", err)
+	}
+}
+
+func TestCTSeeds(t *testing.T) {
+	entries, err := ParseCTEntries(strings.NewReader(testCTResults))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := func(host string) bool {
+		return MatchCTPattern("%subaru%", host)
+	}
+
+	// Each host is only given once, attributed to the oldest certificate
+	// it's on, and invalid names such as localhost are skipped.
+	want := []CTSeed{
+		{Hostname: "jonessubaru.net", Source: "crt.sh %subaru% (certificate 10)"},
+		{Hostname: "smithsubaru.com", Source: "crt.sh %subaru% (certificate 20)"},
+	}
+
+	if got := CTSeeds(entries, filter, "crt.sh %subaru%"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if got := CTSeeds(entries, nil, "saved.json"); len(got) != 3 {
+		t.Errorf("expected every host without a filter, got %v", got)
+	}
+}
@@ -0,0 +1,375 @@
+package discovery
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cheesesashimi/subiescraper/pkg/utils"
+)
+
+// GraphEdge links the host a certificate was served by to another host on
+// that certificate.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Certificate is the SHA-256 fingerprint of the shared certificate.
+	Certificate string `json:"certificate"`
+}
+
+// Graph is every host the crawler has visited or found, with an edge for each
+// certificate two of them share. Dealerships on one certificate almost always
+// belong to the same dealer group, so the connected components of the graph
+// are the dealer groups. It is safe for concurrent use.
+type Graph struct {
+	mu    sync.Mutex
+	hosts map[string]struct{}
+	edges map[GraphEdge]struct{}
+}
+
+// graphFile is how a Graph is saved.
+type graphFile struct {
+	Hosts []string    `json:"hosts"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// NewGraph returns an empty graph.
+func NewGraph() *Graph {
+	return &Graph{
+		hosts: map[string]struct{}{},
+		edges: map[GraphEdge]struct{}{},
+	}
+}
+
+// LoadGraph reads a graph saved with Graph.Save, or returns an empty one if
+// the file doesn't exist.
+func LoadGraph(path string) (*Graph, error) {
+	g := NewGraph()
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	gf := graphFile{}
+	if err := json.Unmarshal(b, &gf); err != nil {
+		return nil, fmt.Errorf("could not parse graph %s: %w", path, err)
+	}
+
+	for _, host := range gf.Hosts {
+		g.AddHost(host)
+	}
+
+	g.AddEdges(gf.Edges...)
+
+	return g, nil
+}
+
+// Save writes the graph to path without ever leaving a partial file behind.
+func (g *Graph) Save(path string) error {
+	b, err := json.Marshal(graphFile{
+		Hosts: g.Hosts(),
+		Edges: g.Edges(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, b, 0644)
+}
+
+// AddHost adds a host which may not share a certificate with any other.
+func (g *Graph) AddHost(host string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.hosts[host] = struct{}{}
+}
+
+// AddEdges adds the edges and their hosts. Edges which are already in the
+// graph and edges from a host to itself are ignored.
+func (g *Graph) AddEdges(edges ...GraphEdge) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, e := range edges {
+		g.hosts[e.From] = struct{}{}
+		g.hosts[e.To] = struct{}{}
+
+		if e.From != e.To {
+			g.edges[e] = struct{}{}
+		}
+	}
+}
+
+// Hosts returns every host in the graph, sorted.
+func (g *Graph) Hosts() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	out := []string{}
+	for host := range g.hosts {
+		out = append(out, host)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// Edges returns every edge in the graph, sorted.
+func (g *Graph) Edges() []GraphEdge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	out := []GraphEdge{}
+	for e := range g.edges {
+		out = append(out, e)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].From != out[j].From {
+			return out[i].From < out[j].From
+		}
+
+		if out[i].To != out[j].To {
+			return out[i].To < out[j].To
+		}
+
+		return out[i].Certificate < out[j].Certificate
+	})
+
+	return out
+}
+
+// Groups returns the connected components of the graph, each sorted, from
+// the largest to the smallest. Hosts which don't share a certificate with any
+// other are groups of their own.
+func (g *Graph) Groups() [][]string {
+	hosts := g.Hosts()
+	edges := g.Edges()
+
+	parent := map[string]string{}
+	for _, host := range hosts {
+		parent[host] = host
+	}
+
+	var find func(string) string
+	find = func(host string) string {
+		if parent[host] != host {
+			parent[host] = find(parent[host])
+		}
+
+		return parent[host]
+	}
+
+	for _, e := range edges {
+		from, to := find(e.From), find(e.To)
+		if from == to {
+			continue
+		}
+
+		// The alphabetically first host is the root so that each
+		// group's name doesn't depend on the order of the edges.
+		if from < to {
+			parent[to] = from
+		} else {
+			parent[from] = to
+		}
+	}
+
+	byRoot := map[string][]string{}
+	for _, host := range hosts {
+		root := find(host)
+		byRoot[root] = append(byRoot[root], host)
+	}
+
+	out := [][]string{}
+	for _, group := range byRoot {
+		out = append(out, group)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i]) != len(out[j]) {
+			return len(out[i]) > len(out[j])
+		}
+
+		return out[i][0] < out[j][0]
+	})
+
+	return out
+}
+
+// GroupNames maps each host to the name of its dealer group, which is the
+// alphabetically first host in it. Hosts in a group of their own aren't
+// included.
+func (g *Graph) GroupNames() map[string]string {
+	out := map[string]string{}
+
+	for _, group := range g.Groups() {
+		if len(group) < 2 {
+			continue
+		}
+
+		for _, host := range group {
+			out[host] = group[0]
+		}
+	}
+
+	return out
+}
+
+// GroupName returns the dealer group of the host or URL in groups, as made by
+// GroupNames, or an empty string if it isn't in one.
+func GroupName(groups map[string]string, hostOrURL string) string {
+	host, err := utils.StripHostname(hostOrURL)
+	if err != nil {
+		return ""
+	}
+
+	return groups[host]
+}
+
+// WriteDOT writes the graph in Graphviz's DOT language with each dealer group
+// as a cluster.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	ew := &errWriter{w: w}
+
+	ew.printf("graph dealers {\n")
+
+	for i, group := range g.Groups() {
+		if len(group) < 2 {
+			for _, host := range group {
+				ew.printf("  %s;\n", strconv.Quote(host))
+			}
+			continue
+		}
+
+		ew.printf("  subgraph \"cluster_%d\" {\n", i)
+		ew.printf("    label=%s;\n", strconv.Quote(group[0]))
+		for _, host := range group {
+			ew.printf("    %s;\n", strconv.Quote(host))
+		}
+		ew.printf("  }\n")
+	}
+
+	for _, e := range g.Edges() {
+		ew.printf("  %s -- %s [certificate=%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Certificate))
+	}
+
+	ew.printf("}\n")
+
+	return ew.err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// WriteGraphML writes the graph as GraphML, e.g. for Gephi or yEd, with each
+// host's dealer group and each edge's certificate as attributes.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	groups := g.GroupNames()
+
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "group", For: "node", AttrName: "group", AttrType: "string"},
+			{ID: "certificate", For: "edge", AttrName: "certificate", AttrType: "string"},
+		},
+		Graph: graphMLGraph{
+			ID:          "dealers",
+			EdgeDefault: "undirected",
+			Nodes:       []graphMLNode{},
+			Edges:       []graphMLEdge{},
+		},
+	}
+
+	for _, host := range g.Hosts() {
+		node := graphMLNode{ID: host}
+		if group := groups[host]; group != "" {
+			node.Data = append(node.Data, graphMLData{Key: "group", Value: group})
+		}
+
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+
+	for _, e := range g.Edges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.From,
+			Target: e.To,
+			Data:   []graphMLData{{Key: "certificate", Value: e.Certificate}},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// errWriter keeps the first error from a series of writes so it only has to
+// be checked once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
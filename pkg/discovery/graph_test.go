@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestGraph has two dealer groups, one with a host on two certificates,
+// and a host of its own:
+//
+//	smithsubaru.com -- smithtoyota.com -- smithford.com
+//	jonessubaru.com -- joneshonda.com
+//	brownsubaru.com
+func newTestGraph() *Graph {
+	g := NewGraph()
+	g.AddEdges(
+		GraphEdge{From: "smithtoyota.com", To: "smithford.com", Certificate: "bbbb"},
+		GraphEdge{From: "smithsubaru.com", To: "smithtoyota.com", Certificate: "aaaa"},
+		GraphEdge{From: "joneshonda.com", To: "jonessubaru.com", Certificate: "cccc"},
+		// Duplicates and self edges are ignored.
+		GraphEdge{From: "smithsubaru.com", To: "smithtoyota.com", Certificate: "aaaa"},
+		GraphEdge{From: "jonessubaru.com", To: "jonessubaru.com", Certificate: "cccc"},
+	)
+	g.AddHost("brownsubaru.com")
+
+	return g
+}
+
+func TestGraphGroups(t *testing.T) {
+	g := newTestGraph()
+
+	want := [][]string{
+		{"smithford.com", "smithsubaru.com", "smithtoyota.com"},
+		{"joneshonda.com", "jonessubaru.com"},
+		{"brownsubaru.com"},
+	}
+
+	if got := g.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected groups %v, got %v", want, got)
+	}
+
+	if got := len(g.Edges()); got != 3 {
+		t.Errorf("expected 3 edges, got %d", got)
+	}
+}
+
+func TestGraphGroupNames(t *testing.T) {
+	groups := newTestGraph().GroupNames()
+
+	want := map[string]string{
+		"smithford.com":   "smithford.com",
+		"smithsubaru.com": "smithford.com",
+		"smithtoyota.com": "smithford.com",
+		"joneshonda.com":  "joneshonda.com",
+		"jonessubaru.com": "joneshonda.com",
+	}
+
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("expected group names %v, got %v", want, groups)
+	}
+
+	testCases := []struct {
+		hostOrURL string
+		want      string
+	}{
+		{hostOrURL: "https://www.smithtoyota.com/inventory", want: "smithford.com"},
+		{hostOrURL: "jonessubaru.com", want: "joneshonda.com"},
+		{hostOrURL: "brownsubaru.com", want: ""},
+		{hostOrURL: "unknown.com", want: ""},
+		{hostOrURL: "", want: ""},
+	}
+
+	for _, testCase := range testCases {
+		if got := GroupName(groups, testCase.hostOrURL); got != testCase.want {
+			t.Errorf("GroupName(%q): expected %q, got %q", testCase.hostOrURL, testCase.want, got)
+		}
+	}
+}
+
+func TestGraphWriteDOT(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := newTestGraph().WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `graph dealers {
+  subgraph "cluster_0" {
+    label="smithford.com";
+    "smithford.com";
+    "smithsubaru.com";
+    "smithtoyota.com";
+  }
+  subgraph "cluster_1" {
+    label="joneshonda.com";
+    "joneshonda.com";
+    "jonessubaru.com";
+  }
+  "brownsubaru.com";
+  "joneshonda.com" -- "jonessubaru.com" [certificate="cccc"];
+  "smithsubaru.com" -- "smithtoyota.com" [certificate="aaaa"];
+  "smithtoyota.com" -- "smithford.com" [certificate="bbbb"];
+}
+`
+
+	if got := buf.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestGraphWriteGraphML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := newTestGraph().WriteGraphML(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("expected an XML header, got:\n%s", buf.String())
+	}
+
+	doc := graphML{}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := map[string]string{}
+	for _, node := range doc.Graph.Nodes {
+		group := ""
+		for _, data := range node.Data {
+			if data.Key == "group" {
+				group = data.Value
+			}
+		}
+
+		nodes[node.ID] = group
+	}
+
+	wantNodes := map[string]string{
+		"brownsubaru.com": "",
+		"joneshonda.com":  "joneshonda.com",
+		"jonessubaru.com": "joneshonda.com",
+		"smithford.com":   "smithford.com",
+		"smithsubaru.com": "smithford.com",
+		"smithtoyota.com": "smithford.com",
+	}
+
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("expected nodes %v, got %v", wantNodes, nodes)
+	}
+
+	wantEdges := []graphMLEdge{
+		{Source: "joneshonda.com", Target: "jonessubaru.com", Data: []graphMLData{{Key: "certificate", Value: "cccc"}}},
+		{Source: "smithsubaru.com", Target: "smithtoyota.com", Data: []graphMLData{{Key: "certificate", Value: "aaaa"}}},
+		{Source: "smithtoyota.com", Target: "smithford.com", Data: []graphMLData{{Key: "certificate", Value: "bbbb"}}},
+	}
+
+	if !reflect.DeepEqual(doc.Graph.Edges, wantEdges) {
+		t.Errorf("expected edges %v, got %v", wantEdges, doc.Graph.Edges)
+	}
+}
+
+func TestGraphSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.json")
+
+	g := newTestGraph()
+	if err := g.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadGraph(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.Hosts(), g.Hosts()) {
+		t.Errorf("expected hosts %v, got %v", g.Hosts(), loaded.Hosts())
+	}
+
+	if !reflect.DeepEqual(loaded.Edges(), g.Edges()) {
+		t.Errorf("expected edges %v, got %v", g.Edges(), loaded.Edges())
+	}
+}
+
+func TestLoadGraphMissing(t *testing.T) {
+	g, err := LoadGraph(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := g.Hosts(); len(got) != 0 {
+		t.Errorf("expected an empty graph, got %v", got)
+	}
+}
@@ -0,0 +1,165 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// RuleAction is what a rule does with the hosts it matches.
+type RuleAction string
+
+const (
+	Allow RuleAction = "allow"
+	Deny  RuleAction = "deny"
+)
+
+// Rule allows or denies the hosts matching its pattern. A pattern with
+// wildcards (*, ? or [...]) is matched against the whole hostname, e.g.
+// "*subaru*". A pattern without any matches the host itself and all of its
+// subdomains, so "cloudflare.com" also matches "sni.cloudflare.com".
+type Rule struct {
+	Action  RuleAction
+	Pattern string
+}
+
+// Matches reports whether the rule applies to host.
+func (r Rule) Matches(host string) bool {
+	host = strings.ToLower(host)
+	pattern := strings.ToLower(r.Pattern)
+
+	if strings.ContainsAny(pattern, "*?[") {
+		ok, err := path.Match(pattern, host)
+		return err == nil && ok
+	}
+
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s", r.Action, r.Pattern)
+}
+
+// RuleSet decides which hosts are crawled. The first rule which matches a
+// host wins, and hosts no rule matches get the default action.
+type RuleSet struct {
+	Rules   []Rule
+	Default RuleAction
+}
+
+// Allowed reports whether host should be crawled. It can be used as a
+// Crawler's Filter.
+func (rs RuleSet) Allowed(host string) bool {
+	for _, r := range rs.Rules {
+		if r.Matches(host) {
+			return r.Action == Allow
+		}
+	}
+
+	return rs.Default != Deny
+}
+
+// Prepend returns a copy of the rule set with rules checked before its own.
+func (rs RuleSet) Prepend(rules ...Rule) RuleSet {
+	return RuleSet{
+		Rules:   append(append([]Rule{}, rules...), rs.Rules...),
+		Default: rs.Default,
+	}
+}
+
+func (rs RuleSet) String() string {
+	lines := []string{}
+	for _, r := range rs.Rules {
+		lines = append(lines, r.String())
+	}
+
+	if rs.Default != "" {
+		lines = append(lines, fmt.Sprintf("default %s", rs.Default))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ParseRules reads a rule set with one rule per line:
+//
+//	# shared CDN certificates list thousands of unrelated sites
+//	deny cloudflare.com
+//	allow *subaru*
+//	default deny
+//
+// Blank lines and lines starting with # are ignored. The default action is
+// allow unless a default line says otherwise.
+func ParseRules(text string) (RuleSet, error) {
+	rs := RuleSet{
+		Rules:   []Rule{},
+		Default: Allow,
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return rs, fmt.Errorf("line %d: expected an action and a pattern, got %q", lineNum, line)
+		}
+
+		action, err := parseRuleAction(fields[0], fields[1])
+		if err != nil {
+			return rs, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		if fields[0] == "default" {
+			rs.Default = action
+			continue
+		}
+
+		if _, err := path.Match(fields[1], ""); err != nil {
+			return rs, fmt.Errorf("line %d: invalid pattern %q: %w", lineNum, fields[1], err)
+		}
+
+		rs.Rules = append(rs.Rules, Rule{
+			Action:  action,
+			Pattern: fields[1],
+		})
+	}
+
+	return rs, scanner.Err()
+}
+
+func parseRuleAction(keyword, value string) (RuleAction, error) {
+	action := keyword
+	if keyword == "default" {
+		action = value
+	}
+
+	switch RuleAction(action) {
+	case Allow, Deny:
+		return RuleAction(action), nil
+	default:
+		return "", fmt.Errorf("unknown action %q, expected allow or deny", action)
+	}
+}
+
+// LoadRules reads a rule set from a file in the format ParseRules accepts.
+func LoadRules(filename string) (RuleSet, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	rs, err := ParseRules(string(b))
+	if err != nil {
+		return rs, fmt.Errorf("could not parse rules %s: %w", filename, err)
+	}
+
+	return rs, nil
+}
@@ -28,19 +28,22 @@ func DealersPage(dealers []dealer.Dealer) htmlgo.HTML {
 		var newCars []htmlgo.HTML
 		var usedCars []htmlgo.HTML
 
-		if len(d.New.PageInfo.TrackingData) != 0 {
+		newVehicles := d.VehiclesByCondition(dealer.ConditionNew)
+		usedVehicles := d.VehiclesByCondition(dealer.ConditionUsed)
+
+		if len(newVehicles) != 0 {
 			newCars = []htmlgo.HTML{
 				htmlgo.H3_("New Cars:"),
-				getInventoryTable(d.New),
+				getInventoryTable(newVehicles),
 			}
 		} else {
 			newCars = []htmlgo.HTML{htmlgo.H3_("No new cars")}
 		}
 
-		if len(d.Used.PageInfo.TrackingData) != 0 {
+		if len(usedVehicles) != 0 {
 			usedCars = []htmlgo.HTML{
 				htmlgo.H3_("Used Cars:"),
-				getInventoryTable(d.Used),
+				getInventoryTable(usedVehicles),
 			}
 		} else {
 			usedCars = []htmlgo.HTML{htmlgo.H3_("No used cars")}
@@ -49,6 +52,9 @@ func DealersPage(dealers []dealer.Dealer) htmlgo.HTML {
 		c := htmlgo.Div_(
 			htmlgo.Div_(
 				htmlgo.H2_(htmlgo.Text(d.Dealer.Name)),
+				htmlgo.P_(htmlgo.A([]a.Attribute{a.Href_(d.Dealer.SiteURL)}, htmlgo.Text(d.Dealer.SiteURL))),
+				getDealerGroup(d.Dealer),
+				getRedirects(d.Dealer),
 			),
 			htmlgo.Div_(newCars...),
 			htmlgo.Div_(usedCars...),
@@ -63,16 +69,47 @@ func DealersPage(dealers []dealer.Dealer) htmlgo.HTML {
 	)
 }
 
-func getInventoryTable(inventory dealer.InventoryResponse) htmlgo.HTML {
-	sort.Slice(inventory.PageInfo.TrackingData, func(i, j int) bool {
-		return inventory.PageInfo.TrackingData[i].ModelYear > inventory.PageInfo.TrackingData[j].ModelYear
+func getInventoryTable(vehicles []dealer.Vehicle) htmlgo.HTML {
+	sort.Slice(vehicles, func(i, j int) bool {
+		return vehicles[i].Year > vehicles[j].Year
 	})
 
 	listItems := []htmlgo.HTML{}
-	for _, item := range inventory.PageInfo.TrackingData {
-		carLine := fmt.Sprintf("%d %s %s %s (%s)", item.ModelYear, item.Make, item.Model, item.Trim, item.ExteriorColor)
+	for _, item := range vehicles {
+		carLine := fmt.Sprintf("%d %s %s %s (%s)", item.Year, item.Make, item.Model, item.Trim, item.ExteriorColor)
 		listItems = append(listItems, htmlgo.Li_(htmlgo.A([]a.Attribute{a.Href_(item.Link)}, htmlgo.Text(carLine))))
 	}
 
 	return htmlgo.Ul_(listItems...)
 }
+
+func getDealerGroup(d dealer.DealerResponse) htmlgo.HTML {
+	if d.DealerGroup == "" {
+		return htmlgo.HTML("")
+	}
+
+	return htmlgo.P_(htmlgo.Text(fmt.Sprintf("Dealer group: %s", d.DealerGroup)))
+}
+
+// getRedirects shows how the dealer's SiteURL from the dealer locator got to
+// the website its inventory came from, if it was redirected.
+func getRedirects(d dealer.DealerResponse) htmlgo.HTML {
+	if len(d.Redirects) < 2 {
+		return htmlgo.HTML("")
+	}
+
+	title := "Redirects:"
+	if d.OffSiteRedirect {
+		title = "Redirects (to another domain):"
+	}
+
+	listItems := []htmlgo.HTML{}
+	for _, hop := range d.Redirects {
+		listItems = append(listItems, htmlgo.Li_(htmlgo.Text(hop.String())))
+	}
+
+	return htmlgo.Div_(
+		htmlgo.P_(htmlgo.Text(title)),
+		htmlgo.Ol_(listItems...),
+	)
+}
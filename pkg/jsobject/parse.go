@@ -0,0 +1,724 @@
+// Package jsobject parses JavaScript object and array literals, such as the
+// ones dealer websites assign to DDC.dataLayer, into the same types that
+// encoding/json produces (map[string]interface{}, []interface{}, string,
+// float64, bool and nil).
+//
+// The parser is tolerant of the things people write in JavaScript but not in
+// JSON: unquoted and single-quoted keys, single-quoted and template strings,
+// trailing commas, comments, hex numbers, undefined and string concatenation.
+// Any other expression, such as a function call, a variable reference, a
+// regular expression or a template with substitutions, is returned as an
+// Expression holding its source text instead of failing the whole parse.
+package jsobject
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expression is the source text of a value the parser does not evaluate.
+type Expression string
+
+// SyntaxError describes where the input could not be parsed.
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (s *SyntaxError) Error() string {
+	return fmt.Sprintf("jsobject: %s at offset %d", s.Msg, s.Offset)
+}
+
+// Parse parses the first value in src. Anything after the value is ignored.
+func Parse(src string) (interface{}, error) {
+	v, _, err := ParsePrefix(src)
+	return v, err
+}
+
+// ParsePrefix parses the first value in src and returns it along with the
+// offset of the first byte after it.
+func ParsePrefix(src string) (interface{}, int, error) {
+	p := &parser{src: src}
+	p.skipSpace()
+
+	v, err := p.parseTerm()
+	if err != nil {
+		return nil, p.pos, err
+	}
+
+	return v, p.pos, nil
+}
+
+type parser struct {
+	src string
+	pos int
+
+	// substitution is set when a template literal turns out to have a
+	// ${} substitution, which makes it an expression rather than a string.
+	substitution bool
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+
+	return p.src[p.pos]
+}
+
+// skipSpace skips whitespace and comments.
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		switch {
+		case unicode.IsSpace(r) || r == '\ufeff':
+			p.pos += size
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			end := strings.IndexAny(p.src[p.pos:], "\r\n")
+			if end == -1 {
+				p.pos = len(p.src)
+				return
+			}
+			p.pos += end
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end == -1 {
+				p.pos = len(p.src)
+				return
+			}
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+// parseValue parses a value nested inside an object or an array.
+func (p *parser) parseValue() (interface{}, error) {
+	start := p.pos
+
+	v, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := v.(Expression); ok {
+		return v, nil
+	}
+
+	// Anything other than a separator after the value means it was part of
+	// a larger expression, e.g. 1 + x or "foo".length, so keep the source.
+	p.skipSpace()
+	if !p.eof() && !isTerminator(p.peek()) {
+		p.pos = start
+		return p.parseExpression()
+	}
+
+	return v, nil
+}
+
+func (p *parser) parseTerm() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end of input")
+	}
+
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"' || c == '\'' || c == '`':
+		start := p.pos
+		v, err := p.parseStringConcat()
+		if err != nil && p.substitution {
+			p.substitution = false
+			p.pos = start
+			return p.parseExpression()
+		}
+		return v, err
+	case isDigit(c) || ((c == '-' || c == '+' || c == '.') && p.pos+1 < len(p.src) && (isDigit(p.src[p.pos+1]) || p.src[p.pos+1] == '.')):
+		start := p.pos
+		v, err := p.parseNumber()
+		if err != nil {
+			// Something like -.foo isn't a number after all.
+			p.pos = start
+			return p.parseExpression()
+		}
+		return v, nil
+	default:
+		return p.parseIdentOrExpression()
+	}
+}
+
+func (p *parser) parseObject() (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+
+	// Skip the opening brace.
+	p.pos++
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated object")
+		}
+
+		if p.peek() == '}' {
+			p.pos++
+			return out, nil
+		}
+
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+
+		// Shorthand properties ({ foo }) refer to a variable we can't see.
+		if p.peek() == ',' || p.peek() == '}' {
+			out[key] = Expression(key)
+			continue
+		}
+
+		if p.peek() != ':' {
+			return nil, p.errorf("expected ':' after object key %q", key)
+		}
+
+		p.pos++
+		p.skipSpace()
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		out[key] = v
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			if p.eof() {
+				return nil, p.errorf("unterminated object")
+			}
+			return nil, p.errorf("expected ',' or '}' after value for key %q", key)
+		}
+	}
+}
+
+func (p *parser) parseKey() (string, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'' || c == '`':
+		return p.parseString()
+	case c == '[':
+		// Computed key, e.g. ['dealership']
+		p.pos++
+		p.skipSpace()
+		v, err := p.parseValue()
+		if err != nil {
+			return "", err
+		}
+		p.skipSpace()
+		if p.peek() != ']' {
+			return "", p.errorf("expected ']' after computed key")
+		}
+		p.pos++
+		return fmt.Sprint(v), nil
+	case isDigit(c):
+		v, err := p.parseNumber()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		ident := p.parseIdent()
+		if ident == "" {
+			return "", p.errorf("unexpected character %q in object key", c)
+		}
+		return ident, nil
+	}
+}
+
+func (p *parser) parseArray() ([]interface{}, error) {
+	out := []interface{}{}
+
+	// Skip the opening bracket.
+	p.pos++
+
+	expectValue := true
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+
+		switch p.peek() {
+		case ']':
+			p.pos++
+			return out, nil
+		case ',':
+			// A comma where we expected a value is a hole, e.g. [1,,2].
+			if expectValue {
+				out = append(out, nil)
+			}
+			p.pos++
+			expectValue = true
+			continue
+		}
+
+		if !expectValue {
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, v)
+		expectValue = false
+	}
+}
+
+// parseStringConcat parses a string along with any other strings joined to it
+// with +, e.g. "foo" + 'bar'.
+func (p *parser) parseStringConcat() (interface{}, error) {
+	s, err := p.parseString()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		save := p.pos
+		p.skipSpace()
+		if p.peek() != '+' {
+			p.pos = save
+			return s, nil
+		}
+
+		p.pos++
+		p.skipSpace()
+
+		if c := p.peek(); c != '"' && c != '\'' && c != '`' {
+			p.pos = save
+			return s, nil
+		}
+
+		next, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+
+		s += next
+	}
+}
+
+func (p *parser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+
+	var sb strings.Builder
+
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+
+		c := p.src[p.pos]
+
+		switch {
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		case c == '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		case quote == '`' && strings.HasPrefix(p.src[p.pos:], "${"):
+			p.substitution = true
+			return "", p.errorf("template literal substitutions are not supported")
+		case (c == '\n' || c == '\r') && quote != '`':
+			return "", p.errorf("newline in string")
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) parseEscape(sb *strings.Builder) error {
+	// Skip the backslash.
+	p.pos++
+	if p.eof() {
+		return p.errorf("unterminated escape sequence")
+	}
+
+	c := p.src[p.pos]
+	p.pos++
+
+	switch c {
+	case 'n':
+		sb.WriteByte('\n')
+	case 't':
+		sb.WriteByte('\t')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'v':
+		sb.WriteByte('\v')
+	case '0':
+		sb.WriteByte(0)
+	case '\r':
+		// Line continuation, also swallow the \n of a \r\n.
+		if p.peek() == '\n' {
+			p.pos++
+		}
+	case '\n':
+		// Line continuation.
+	case 'x':
+		r, err := p.parseHex(2)
+		if err != nil {
+			return err
+		}
+		sb.WriteRune(r)
+	case 'u':
+		r, err := p.parseUnicodeEscape()
+		if err != nil {
+			return err
+		}
+		sb.WriteRune(r)
+	default:
+		// Any other escaped character, including quotes and backslashes,
+		// stands for itself.
+		p.pos--
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		sb.WriteRune(r)
+		p.pos += size
+	}
+
+	return nil
+}
+
+func (p *parser) parseUnicodeEscape() (rune, error) {
+	if p.peek() == '{' {
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end == -1 {
+			return 0, p.errorf("unterminated unicode escape")
+		}
+		n, err := strconv.ParseUint(p.src[p.pos+1:p.pos+end], 16, 32)
+		if err != nil {
+			return 0, p.errorf("invalid unicode escape")
+		}
+		p.pos += end + 1
+		return rune(n), nil
+	}
+
+	r, err := p.parseHex(4)
+	if err != nil {
+		return 0, err
+	}
+
+	// Combine UTF-16 surrogate pairs, e.g. \ud83d\ude97.
+	if r >= 0xd800 && r < 0xdc00 && strings.HasPrefix(p.src[p.pos:], "\\u") {
+		save := p.pos
+		p.pos += 2
+		low, err := p.parseHex(4)
+		if err == nil && low >= 0xdc00 && low < 0xe000 {
+			return (r-0xd800)<<10 + (low - 0xdc00) + 0x10000, nil
+		}
+		p.pos = save
+	}
+
+	return r, nil
+}
+
+func (p *parser) parseHex(digits int) (rune, error) {
+	if p.pos+digits > len(p.src) {
+		return 0, p.errorf("short hex escape")
+	}
+
+	n, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid hex escape")
+	}
+
+	p.pos += digits
+	return rune(n), nil
+}
+
+func (p *parser) parseNumber() (float64, error) {
+	start := p.pos
+
+	sign := 1.0
+	switch p.peek() {
+	case '-':
+		sign = -1
+		p.pos++
+	case '+':
+		p.pos++
+	}
+
+	rest := p.src[p.pos:]
+	if len(rest) > 2 && rest[0] == '0' && strings.ContainsRune("xXoObB", rune(rest[1])) {
+		base := map[byte]int{'x': 16, 'X': 16, 'o': 8, 'O': 8, 'b': 2, 'B': 2}[rest[1]]
+		end := 2
+		for end < len(rest) && isAlnum(rest[end]) {
+			end++
+		}
+		n, err := strconv.ParseUint(strings.ReplaceAll(rest[2:end], "_", ""), base, 64)
+		if err != nil {
+			p.pos = start
+			return 0, p.errorf("invalid number %q", rest[:end])
+		}
+		p.pos += end
+		return sign * float64(n), nil
+	}
+
+	end := 0
+	for end < len(rest) {
+		c := rest[end]
+		if isDigit(c) || c == '.' || c == '_' {
+			end++
+			continue
+		}
+
+		if (c == 'e' || c == 'E') && end+1 < len(rest) {
+			end++
+			if rest[end] == '+' || rest[end] == '-' {
+				end++
+			}
+			continue
+		}
+
+		break
+	}
+
+	f, err := strconv.ParseFloat(strings.ReplaceAll(rest[:end], "_", ""), 64)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("invalid number %q", rest[:end])
+	}
+
+	p.pos += end
+	return sign * f, nil
+}
+
+func (p *parser) parseIdent() string {
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if r == '_' || r == '$' || unicode.IsLetter(r) || (p.pos > start && unicode.IsDigit(r)) {
+			p.pos += size
+			continue
+		}
+		break
+	}
+
+	return p.src[start:p.pos]
+}
+
+func (p *parser) parseIdentOrExpression() (interface{}, error) {
+	start := p.pos
+
+	switch p.parseIdent() {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "undefined":
+		return nil, nil
+	}
+
+	p.pos = start
+	return p.parseExpression()
+}
+
+// parseExpression consumes source text up to the next separator that is not
+// nested inside brackets or a string and returns it as an Expression.
+func (p *parser) parseExpression() (interface{}, error) {
+	start := p.pos
+	depth := 0
+
+	for !p.eof() {
+		c := p.peek()
+
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			if err := p.skipString(); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(p.src[p.pos:], "//") || strings.HasPrefix(p.src[p.pos:], "/*"):
+			p.skipSpace()
+			continue
+		case c == '/' && p.regexAllowed(start):
+			if err := p.skipRegex(); err != nil {
+				return nil, err
+			}
+			continue
+		case c == '{' || c == '[' || c == '(':
+			depth++
+		case c == '}' || c == ']' || c == ')':
+			if depth == 0 {
+				return p.finishExpression(start)
+			}
+			depth--
+		case (c == ',' || c == ';') && depth == 0:
+			return p.finishExpression(start)
+		}
+
+		p.pos++
+	}
+
+	if depth != 0 {
+		return nil, p.errorf("unterminated expression")
+	}
+
+	return p.finishExpression(start)
+}
+
+// skipString skips a string inside an expression, including a template
+// literal with substitutions.
+func (p *parser) skipString() error {
+	if p.peek() != '`' {
+		_, err := p.parseString()
+		return err
+	}
+
+	// Skip the opening backtick.
+	p.pos++
+
+	for !p.eof() {
+		switch {
+		case p.peek() == '\\':
+			p.pos += 2
+		case p.peek() == '`':
+			p.pos++
+			return nil
+		case strings.HasPrefix(p.src[p.pos:], "${"):
+			p.pos += 2
+			if err := p.skipSubstitution(); err != nil {
+				return err
+			}
+		default:
+			p.pos++
+		}
+	}
+
+	return p.errorf("unterminated string")
+}
+
+// skipSubstitution skips the inside of a template literal's ${}, which can
+// have strings and braces of its own, along with its closing brace.
+func (p *parser) skipSubstitution() error {
+	depth := 0
+
+	for !p.eof() {
+		switch c := p.peek(); c {
+		case '"', '\'', '`':
+			if err := p.skipString(); err != nil {
+				return err
+			}
+			continue
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				p.pos++
+				return nil
+			}
+			depth--
+		}
+
+		p.pos++
+	}
+
+	return p.errorf("unterminated template literal substitution")
+}
+
+// regexAllowed reports whether a / at the current position starts a regular
+// expression rather than being a division, which is the case at the start of
+// the expression or after an operator or opening bracket.
+func (p *parser) regexAllowed(start int) bool {
+	i := p.pos - 1
+	for i >= start && (p.src[i] == ' ' || p.src[i] == '\t' || p.src[i] == '\n' || p.src[i] == '\r') {
+		i--
+	}
+
+	return i < start || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", p.src[i]) != -1
+}
+
+// skipRegex skips a regular expression literal and its flags. Quotes inside
+// it, e.g. /re'gex/, don't start a string.
+func (p *parser) skipRegex() error {
+	// Skip the opening slash.
+	p.pos++
+
+	inClass := false
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == '\\':
+			p.pos += 2
+			continue
+		case c == '\n' || c == '\r':
+			return p.errorf("unterminated regular expression")
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			p.pos++
+			for !p.eof() && isAlnum(p.peek()) {
+				p.pos++
+			}
+			return nil
+		}
+
+		p.pos++
+	}
+
+	return p.errorf("unterminated regular expression")
+}
+
+func (p *parser) finishExpression(start int) (interface{}, error) {
+	expr := strings.TrimSpace(p.src[start:p.pos])
+	if expr == "" {
+		return nil, p.errorf("expected a value")
+	}
+
+	return Expression(expr), nil
+}
+
+func isTerminator(c byte) bool {
+	return c == ',' || c == '}' || c == ']' || c == ')' || c == ';'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
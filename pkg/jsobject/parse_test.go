@@ -0,0 +1,139 @@
+package jsobject
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want interface{}
+	}{
+		{
+			name: "json",
+			src:  `{"a": 1, "b": [true, false, null], "c": "d"}`,
+			want: map[string]interface{}{"a": 1.0, "b": []interface{}{true, false, nil}, "c": "d"},
+		},
+		{
+			name: "unquoted and single-quoted keys",
+			src:  `{a: 'x', 'b': "y"}`,
+			want: map[string]interface{}{"a": "x", "b": "y"},
+		},
+		{
+			name: "trailing commas",
+			src:  `{a: [1, 2,], b: 3,}`,
+			want: map[string]interface{}{"a": []interface{}{1.0, 2.0}, "b": 3.0},
+		},
+		{
+			name: "holes",
+			src:  `[1,,2]`,
+			want: []interface{}{1.0, nil, 2.0},
+		},
+		{
+			name: "hex",
+			src:  `{a: 0x1F}`,
+			want: map[string]interface{}{"a": 31.0},
+		},
+		{
+			name: "leading dot",
+			src:  `[-.5, .25]`,
+			want: []interface{}{-0.5, 0.25},
+		},
+		{
+			name: "comments",
+			src: `{
+				// line comment
+				a: 1, /* block comment */ b: 2
+			}`,
+			want: map[string]interface{}{"a": 1.0, "b": 2.0},
+		},
+		{
+			name: "undefined",
+			src:  `{a: undefined}`,
+			want: map[string]interface{}{"a": nil},
+		},
+		{
+			name: "concatenation across a newline",
+			src: `{a: "foo" +
+				'bar'}`,
+			want: map[string]interface{}{"a": "foobar"},
+		},
+		{
+			name: "template without substitutions",
+			src:  "{a: `foo`}",
+			want: map[string]interface{}{"a": "foo"},
+		},
+		{
+			name: "call",
+			src:  `{phone: getPhone(), b: 1}`,
+			want: map[string]interface{}{"phone": Expression("getPhone()"), "b": 1.0},
+		},
+		{
+			name: "function",
+			src:  `{f: function(a, b) { return {x: a, y: b}; }, b: 1}`,
+			want: map[string]interface{}{"f": Expression("function(a, b) { return {x: a, y: b}; }"), "b": 1.0},
+		},
+		{
+			name: "template with substitutions",
+			src:  "{a: `foo ${bar({x: '}'})} baz`, b: 1}",
+			want: map[string]interface{}{"a": Expression("`foo ${bar({x: '}'})} baz`"), "b": 1.0},
+		},
+		{
+			name: "concatenation with a template with substitutions",
+			src:  "{a: 'foo' + `${bar}`, b: 1}",
+			want: map[string]interface{}{"a": Expression("'foo' + `${bar}`"), "b": 1.0},
+		},
+		{
+			name: "regex",
+			src:  `{a: /re'gex/gi, b: 1}`,
+			want: map[string]interface{}{"a": Expression("/re'gex/gi"), "b": 1.0},
+		},
+		{
+			name: "regex with a slash in a class",
+			src:  `{a: x.replace(/[/"]/g, ''), b: 1}`,
+			want: map[string]interface{}{"a": Expression(`x.replace(/[/"]/g, '')`), "b": 1.0},
+		},
+		{
+			name: "division",
+			src:  `{a: x / 2, b: 1}`,
+			want: map[string]interface{}{"a": Expression("x / 2"), "b": 1.0},
+		},
+		{
+			name: "not a number",
+			src:  `{a: -.foo, b: 1}`,
+			want: map[string]interface{}{"a": Expression("-.foo"), "b": 1.0},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := Parse(testCase.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("expected %#v, got %#v", testCase.want, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []string{
+		`{a: 1`,
+		`[1, 2`,
+		`{a 1}`,
+		`{a: "foo}`,
+		"{a: `foo ${bar`}",
+		"{a: /regex\n}",
+	}
+
+	for _, src := range testCases {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("expected an error parsing %q", src)
+		}
+	}
+}
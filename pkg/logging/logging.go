@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	FormatText string = "text"
+	FormatJSON string = "json"
+)
+
+// Flags returns the --log-level and --log-format flags shared by the CLIs.
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "log-level",
+			Usage: "Minimum level to log: debug, info, warn or error",
+			Value: "info",
+		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Usage: "Log output format: text or json",
+			Value: FormatText,
+		},
+	}
+}
+
+// FromContext builds a logger which writes to stderr from the flags returned
+// by Flags.
+func FromContext(c *cli.Context) (*slog.Logger, error) {
+	return New(os.Stderr, c.String("log-level"), c.String("log-format"))
+}
+
+// New builds a logger which writes to w at the given level and format.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be one of: %s, %s", format, FormatText, FormatJSON)
+	}
+}
+
+// Discard returns a logger which drops everything written to it.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ErrInvalidHostname is wrapped by the errors returned when a hostname or URL
+// can't be normalized.
+var ErrInvalidHostname = errors.New("invalid hostname")
+
+// idnaProfile converts internationalized hostnames to their ASCII (punycode)
+// form the same way browsers do, so they can be compared with the names on
+// certificates.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(true),
+	idna.BidiRule(),
+)
+
+func invalidHostname(hostname string, reason error) error {
+	return fmt.Errorf("%w %q: %s", ErrInvalidHostname, hostname, reason)
+}
+
+// NormalizeHostname turns a hostname, URL or certificate DNS name into a bare
+// lowercase ASCII hostname. It strips any scheme, path, port, trailing dot and
+// leading "*." wildcard label, and converts internationalized names to
+// punycode:
+//
+//	https://WWW.Example.com:8443/inventory -> www.example.com
+//	*.dealer.co.uk                          -> dealer.co.uk
+//	bücher.example                          -> xn--bcher-kva.example
+func NormalizeHostname(hostname string) (string, error) {
+	in := hostname
+
+	hostname = strings.TrimSpace(hostname)
+	if hostname == "" {
+		return "", invalidHostname(in, errors.New("empty"))
+	}
+
+	if strings.Contains(hostname, "://") {
+		u, err := url.Parse(hostname)
+		if err != nil {
+			return "", invalidHostname(in, err)
+		}
+
+		hostname = u.Host
+	} else if i := strings.IndexAny(hostname, "/?#"); i != -1 {
+		hostname = hostname[:i]
+	}
+
+	if h, port, err := net.SplitHostPort(hostname); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); port != "" && err != nil {
+			return "", invalidHostname(in, fmt.Errorf("invalid port %q", port))
+		}
+
+		hostname = h
+	}
+
+	hostname = strings.TrimPrefix(hostname, "*.")
+	hostname = strings.TrimSuffix(hostname, ".")
+
+	if hostname == "" {
+		return "", invalidHostname(in, errors.New("no hostname"))
+	}
+
+	if ip := net.ParseIP(strings.Trim(hostname, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+
+	ascii, err := idnaProfile.ToASCII(hostname)
+	if err != nil {
+		return "", invalidHostname(in, err)
+	}
+
+	return strings.ToLower(ascii), nil
+}
+
+// RegistrableDomain returns the part of a hostname a dealer would have
+// registered, its eTLD+1 according to the public suffix list:
+//
+//	www.example.com       -> example.com
+//	shop.dealer.co.uk     -> dealer.co.uk
+//	autos.example.com.mx  -> example.com.mx
+//
+// The hostname is normalized first, so URLs and wildcard names are accepted.
+// IP addresses are returned as they are. Single labels such as localhost and
+// public suffixes themselves such as co.uk are an error.
+func RegistrableDomain(hostname string) (string, error) {
+	normalized, err := NormalizeHostname(hostname)
+	if err != nil {
+		return "", err
+	}
+
+	if net.ParseIP(normalized) != nil {
+		return normalized, nil
+	}
+
+	if !strings.Contains(normalized, ".") {
+		return "", invalidHostname(hostname, errors.New("single label"))
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(normalized)
+	if err != nil {
+		return "", invalidHostname(hostname, err)
+	}
+
+	return domain, nil
+}
+
+// HostnameToURL returns the URL of the website for a hostname, which is the
+// www host of its registrable domain.
+func HostnameToURL(hostname string) (string, error) {
+	domain, err := RegistrableDomain(hostname)
+	if err != nil {
+		return "", err
+	}
+
+	host := "www." + domain
+	if ip := net.ParseIP(domain); ip != nil {
+		host = domain
+		if ip.To4() == nil {
+			host = "[" + domain + "]"
+		}
+	}
+
+	u := url.URL{
+		Scheme: "https",
+		Host:   host,
+	}
+
+	return u.String(), nil
+}
+
+// URLToHostname returns the registrable domain of a URL's host.
+func URLToHostname(inURL string) (string, error) {
+	u, err := url.Parse(inURL)
+	if err != nil {
+		return "", invalidHostname(inURL, err)
+	}
+
+	if u.Host == "" {
+		return "", invalidHostname(inURL, errors.New("no host in URL"))
+	}
+
+	return RegistrableDomain(u.Host)
+}
+
+// StripHostname returns the registrable domain of a hostname or URL, so that
+// every host of a dealer maps to the same name.
+func StripHostname(hostname string) (string, error) {
+	return RegistrableDomain(hostname)
+}
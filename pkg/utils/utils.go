@@ -1,42 +1,39 @@
 package utils
 
 import (
-	"net/url"
-	"strings"
+	"os"
+	"path/filepath"
 )
 
-func HostnameToURL(hostname string) string {
-	slicedHostname := getSlicedHostname(hostname)
-	slicedHostname = append([]string{"www"}, slicedHostname...)
-
-	u := url.URL{
-		Scheme: "https",
-		Host:   strings.Join(slicedHostname, "."),
+// WriteFileAtomic writes data to a temporary file next to filename and renames
+// it into place, so filename is never left half-written if the program is
+// interrupted.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
 	}
 
-	return u.String()
-}
+	// Clean up after any failure below; this is a no-op after the rename.
+	defer os.Remove(tmp.Name())
 
-func URLToHostname(inURL string) string {
-	u, err := url.Parse(inURL)
-	if err != nil {
-		panic(err)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
 	}
 
-	return getTopLevelHostname(u.Host)
-}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
 
-func StripHostname(hostname string) string {
-	return getTopLevelHostname(hostname)
-}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
 
-func getTopLevelHostname(hostname string) string {
-	return strings.Join(getSlicedHostname(hostname), ".")
-}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
 
-func getSlicedHostname(hostname string) []string {
-	hostname = strings.ReplaceAll(hostname, "https://", "")
-	hostname = strings.ToLower(hostname)
-	split := strings.Split(hostname, ".")
-	return split[len(split)-2 : len(split)]
+	return os.Rename(tmp.Name(), filename)
 }